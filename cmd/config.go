@@ -0,0 +1,173 @@
+/*
+Copyright © 2021 Anton Brekhov <anton@abrekhov.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/abrekhov/hypertunnel/pkg/datachannel"
+	"github.com/abrekhov/hypertunnel/pkg/transfer"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// envPrefix prefixes environment variables, e.g. HT_TURN_USER sets --turn-user
+const envPrefix = "HT"
+
+// Config is runtime configuration of ht assembled from flags, environment and
+// config file
+type Config struct {
+	// File is sent file, empty for receiver
+	File string
+	// URL is streamed instead of File
+	URL string
+	// Code pairs peers on Relay, empty exchanges signals by copy-paste
+	Code  string
+	Relay string
+	// QR prints local signal as QR code too
+	QR bool
+	// Clipboard copies local signal and takes the peer one from clipboard
+	Clipboard bool
+	// ChunkSize is size of data messages sent
+	ChunkSize int
+	// RateLimit is send speed limit in bytes per second, 0 is unlimited
+	RateLimit int64
+	// AcceptTimeout limits waiting for the receiver to accept, 0 is unlimited
+	AcceptTimeout time.Duration
+	// Password encrypts transferred data, empty sends it as is
+	Password string
+	// Output "-" writes received file to stdout instead of the working directory
+	Output string
+	// LogFile gets a JSON summary line per transfer
+	LogFile string
+	// ConnectRetries is how many times failed connection is retried
+	ConnectRetries int
+	// ConnectTimeout bounds one connection attempt, 0 is unlimited
+	ConnectTimeout time.Duration
+	// SignalTTL is maximum age of accepted peer signal, 0 is unlimited
+	SignalTTL time.Duration
+	Network   NetworkConfig
+	TURN      TURNConfig
+	Transfer  datachannel.Config
+}
+
+// NetworkConfig limits which local candidates are gathered and advertised
+type NetworkConfig struct {
+	// NoMDNS disables mDNS .local host candidates
+	NoMDNS bool
+	// Interface limits gathering to one network interface, empty uses all
+	Interface string
+	// NoHostCandidates keeps local interface addresses out of the signal
+	NoHostCandidates bool
+	// RelayOnly gathers TURN relay candidates only
+	RelayOnly bool
+}
+
+// TURNConfig is TURN servers relaying traffic when peers can't connect directly
+type TURNConfig struct {
+	URLs     []string
+	User     string
+	Password string
+	// Proxy reaches TCP/TLS TURN servers, socks5:// or http://
+	Proxy string
+}
+
+// bindEnv makes v read settings from HT_ prefixed environment variables
+func bindEnv(v *viper.Viper) {
+	v.SetEnvPrefix(envPrefix)
+	v.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
+	v.AutomaticEnv()
+}
+
+// loadConfig assembles Config. Flags set on command line win over environment,
+// environment wins over config file read into v, flag defaults come last.
+func loadConfig(flags *pflag.FlagSet, v *viper.Viper) (Config, error) {
+	if err := v.BindPFlags(flags); err != nil {
+		return Config{}, err
+	}
+	// ht send and ht receive don't define flags of the other side
+	defaults := datachannel.DefaultConfig()
+	v.SetDefault("chunk-size", datachannel.DefaultChunkSize)
+	v.SetDefault("collision-format", string(defaults.CollisionFormat))
+	v.SetDefault("flush-interval", defaults.FlushInterval)
+	rate, err := transfer.ParseSize(v.GetString("rate"))
+	if err != nil {
+		return Config{}, err
+	}
+	collision, err := transfer.ParseCollisionStrategy(v.GetString("collision-format"))
+	if err != nil {
+		return Config{}, err
+	}
+	cfg := Config{
+		File:           v.GetString("file"),
+		URL:            v.GetString("url"),
+		Code:           v.GetString("code"),
+		Relay:          v.GetString("relay"),
+		QR:             v.GetBool("qr"),
+		Clipboard:      v.GetBool("clipboard"),
+		RateLimit:      rate,
+		ChunkSize:      v.GetInt("chunk-size"),
+		AcceptTimeout:  v.GetDuration("accept-timeout"),
+		SignalTTL:      v.GetDuration("signal-ttl"),
+		LogFile:        v.GetString("log-file"),
+		Output:         v.GetString("output"),
+		Password:       v.GetString("password"),
+		ConnectRetries: v.GetInt("connect-retries"),
+		ConnectTimeout: v.GetDuration("connect-timeout"),
+		Network: NetworkConfig{
+			NoMDNS:           v.GetBool("no-mdns"),
+			Interface:        v.GetString("interface"),
+			NoHostCandidates: v.GetBool("no-host-candidates"),
+			RelayOnly:        v.GetBool("relay-only"),
+		},
+		TURN: TURNConfig{
+			URLs:     v.GetStringSlice("turn"),
+			User:     v.GetString("turn-user"),
+			Password: v.GetString("turn-password"),
+			Proxy:    v.GetString("turn-proxy"),
+		},
+		Transfer: datachannel.Config{
+			AutoAccept:      v.GetBool("auto-accept"),
+			Force:           v.GetBool("force"),
+			Fsync:           v.GetBool("fsync"),
+			CollisionFormat: collision,
+			FlushInterval:   v.GetDuration("flush-interval"),
+			IdleTimeout:     v.GetDuration("idle-timeout"),
+			MaxConnections:  v.GetInt("max-connections"),
+		},
+	}
+	if cfg.File != "" && cfg.URL != "" {
+		return Config{}, errors.New("--file and --url can't be used together")
+	}
+	if cfg.Output != "" && cfg.Output != "-" {
+		return Config{}, errors.New("--output supports only - (stdout)")
+	}
+	if cfg.Output != "" && (cfg.File != "" || cfg.URL != "") {
+		return Config{}, errors.New("--output is for receiving, it can't be used with --file or --url")
+	}
+	if cfg.ConnectRetries < 0 {
+		return Config{}, errors.New("--connect-retries can't be negative")
+	}
+	if cfg.Network.RelayOnly && len(cfg.TURN.URLs) == 0 {
+		return Config{}, errors.New("--relay-only requires --turn")
+	}
+	if cfg.Code != "" && cfg.Relay == "" {
+		return Config{}, errors.New("--code requires --relay")
+	}
+	return cfg, nil
+}
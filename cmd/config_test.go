@@ -0,0 +1,105 @@
+/*
+Copyright © 2021 Anton Brekhov <anton@abrekhov.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/abrekhov/hypertunnel/pkg/transfer"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "hypertunnel.yaml")
+	err := os.WriteFile(file, []byte(`
+rate: 10MB
+turn-user: fileuser
+turn-password: filepass
+collision-format: dot
+force: true
+`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("HT_RATE", "5MB")
+	t.Setenv("HT_TURN_USER", "envuser")
+	t.Setenv("HT_IDLE_TIMEOUT", "30s")
+	t.Setenv("HT_NO_MDNS", "true")
+
+	flags := pflag.NewFlagSet("ht", pflag.ContinueOnError)
+	addConnectionFlags(flags)
+	if err := flags.Parse([]string{"--rate", "1MB", "--turn", "turns:turn.example.com:5349", "-y"}); err != nil {
+		t.Fatal(err)
+	}
+	v := viper.New()
+	bindEnv(v)
+	v.SetConfigFile(file)
+	if err := v.ReadInConfig(); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := loadConfig(flags, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checks := []struct {
+		name      string
+		got, want interface{}
+	}{
+		{"flag over env and file", cfg.RateLimit, int64(1000000)},
+		{"env over file", cfg.TURN.User, "envuser"},
+		{"env over default", cfg.Transfer.IdleTimeout, 30 * time.Second},
+		{"file over default", cfg.TURN.Password, "filepass"},
+		{"file collision format", cfg.Transfer.CollisionFormat, transfer.CollisionDot},
+		{"file bool", cfg.Transfer.Force, true},
+		{"flag bool", cfg.Transfer.AutoAccept, true},
+		{"env bool", cfg.Network.NoMDNS, true},
+		{"flag slice", cfg.TURN.URLs, []string{"turns:turn.example.com:5349"}},
+		{"default", cfg.Transfer.FlushInterval, time.Second},
+	}
+	for _, c := range checks {
+		if !reflect.DeepEqual(c.got, c.want) {
+			t.Errorf("%s: got %v, want %v", c.name, c.got, c.want)
+		}
+	}
+}
+
+func TestLoadConfigInvalid(t *testing.T) {
+	for _, args := range [][]string{
+		{"--rate", "fast"},
+		{"--collision-format", "random"},
+		{"--file", "a.txt", "--url", "http://example.com/a.txt"},
+		{"--code", "abc123"},
+		{"--relay-only"},
+		{"--connect-retries", "-1"},
+		{"--output", "out.bin"},
+		{"--output", "-", "--file", "a.txt"},
+	} {
+		flags := pflag.NewFlagSet("ht", pflag.ContinueOnError)
+		addConnectionFlags(flags)
+		if err := flags.Parse(args); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loadConfig(flags, viper.New()); err == nil {
+			t.Errorf("loadConfig(%v) expected error", args)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+/*
+Copyright © 2021 Anton Brekhov <anton@abrekhov.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/abrekhov/hypertunnel/pkg/datachannel"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// connectBackoff is the delay before the first reconnect, doubled on each next one
+	connectBackoff = time.Second
+	// maxConnectBackoff caps the delay between reconnects
+	maxConnectBackoff = 30 * time.Second
+)
+
+// errConnectTimeout is returned when transports don't start within Config.ConnectTimeout
+var errConnectTimeout = errors.New("connection timed out")
+
+// connect connects to the other side. Failed transport startup is retried
+// cfg.ConnectRetries times with backoff, each time with fresh candidates and
+// signals exchanged again.
+func connect(cfg Config) (*datachannel.Session, error) {
+	for attempt := 1; ; attempt++ {
+		session, err := newSession(cfg)
+		if err != nil {
+			return nil, err
+		}
+		err = exchange(session, cfg, attempt)
+		if err == nil {
+			return session, nil
+		}
+		session.Close()
+		if !errors.Is(err, datachannel.ErrConnect) && !errors.Is(err, errConnectTimeout) || attempt > cfg.ConnectRetries {
+			return nil, err
+		}
+		delay := backoffDelay(attempt, connectBackoff, maxConnectBackoff)
+		log.Warnf("Connection failed: %v. Retrying in %s (%d/%d), the other side has to retry too\n", err, delay, attempt, cfg.ConnectRetries)
+		time.Sleep(delay)
+	}
+}
+
+// backoffDelay returns delay before reconnect after failed attempt (counted
+// from 1): base doubled for every previous failure, at most max
+func backoffDelay(attempt int, base, max time.Duration) time.Duration {
+	delay := base
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if delay >= max {
+			return max
+		}
+	}
+	if delay > max {
+		return max
+	}
+	return delay
+}
+
+// attemptCode returns relay code for attempt, so signals of failed attempts
+// aren't fetched again
+func attemptCode(code string, attempt int) string {
+	if code == "" || attempt == 1 {
+		return code
+	}
+	return fmt.Sprintf("%s-%d", code, attempt)
+}
+
+// newSession creates session configured by cfg
+func newSession(cfg Config) (*datachannel.Session, error) {
+	api, iceOptions, err := newWebRTCAPI(cfg.TURN, cfg.Network)
+	if err != nil {
+		return nil, err
+	}
+	return datachannel.NewSession(api, iceOptions, datachannel.SessionConfig{
+		ChunkSize:       cfg.ChunkSize,
+		SignalTTL:       cfg.SignalTTL,
+		AcceptTimeout:   cfg.AcceptTimeout,
+		DropMDNS:        cfg.Network.NoMDNS,
+		CandidateFilter: candidateFilter(cfg.Network),
+		Transfer:        cfg.Transfer,
+	})
+}
+
+// exchange swaps signals with the other side and connects to it, giving up
+// after cfg.ConnectTimeout unless it's 0
+func exchange(session *datachannel.Session, cfg Config, attempt int) error {
+	encoded, err := session.LocalSignal()
+	if err != nil {
+		return err
+	}
+	if attempt > 1 && cfg.Code == "" {
+		log.Infoln("Exchange the new signals to reconnect")
+	}
+	cfg.Code = attemptCode(cfg.Code, attempt)
+	// Waiting for encoded signal from other side
+	remote, err := exchangeSignal(cfg, encoded)
+	if err != nil {
+		return err
+	}
+
+	started := make(chan error, 1)
+	go func() {
+		started <- session.SetRemoteSignal(remote)
+	}()
+	if cfg.ConnectTimeout <= 0 {
+		return <-started
+	}
+	select {
+	case err := <-started:
+		return err
+	case <-time.After(cfg.ConnectTimeout):
+		// Caller closes the session, which unblocks SetRemoteSignal
+		return fmt.Errorf("%w after %s", errConnectTimeout, cfg.ConnectTimeout)
+	}
+}
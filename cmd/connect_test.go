@@ -0,0 +1,62 @@
+/*
+Copyright © 2021 Anton Brekhov <anton@abrekhov.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	base, max := time.Second, 30*time.Second
+	want := []time.Duration{
+		time.Second,
+		2 * time.Second,
+		4 * time.Second,
+		8 * time.Second,
+		16 * time.Second,
+		30 * time.Second,
+		30 * time.Second,
+	}
+	for i, w := range want {
+		if got := backoffDelay(i+1, base, max); got != w {
+			t.Errorf("attempt %d: delay = %s, want %s", i+1, got, w)
+		}
+	}
+	if got := backoffDelay(1000, base, max); got != max {
+		t.Errorf("attempt 1000: delay = %s, want %s", got, max)
+	}
+	if got := backoffDelay(1, time.Minute, max); got != max {
+		t.Errorf("base over max: delay = %s, want %s", got, max)
+	}
+}
+
+func TestAttemptCode(t *testing.T) {
+	tests := []struct {
+		code    string
+		attempt int
+		want    string
+	}{
+		{"abc123", 1, "abc123"},
+		{"abc123", 2, "abc123-2"},
+		{"", 3, ""},
+	}
+	for _, tt := range tests {
+		if got := attemptCode(tt.code, tt.attempt); got != tt.want {
+			t.Errorf("attemptCode(%q, %d) = %q, want %q", tt.code, tt.attempt, got, tt.want)
+		}
+	}
+}
@@ -18,19 +18,32 @@ package cmd
 import (
 	"crypto/aes"
 	"crypto/cipher"
+	"errors"
 	"io"
-	"log"
 	"os"
 
+	"github.com/abrekhov/hypertunnel/pkg/cryptoutils"
 	"github.com/abrekhov/hypertunnel/pkg/hashutils"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
+var (
+	// ErrLegacyNotSeekable is returned when legacy file is piped, its IV is at the end
+	ErrLegacyNotSeekable = errors.New("legacy encrypted file must be a regular file, not a stream")
+	// ErrUnknownFormat is returned for input without format header unless
+	// legacy files are allowed
+	ErrUnknownFormat = errors.New("input has no encrypted file header, it's corrupted or was encrypted by an older version (see --legacy)")
+)
+
+// legacyFormat allows decrypting unauthenticated files of older versions
+var legacyFormat bool
+
 // decryptCmd represents the decrypt command
 var decryptCmd = &cobra.Command{
-	Use:   "decrypt",
+	Use:   "decrypt [file]",
 	Short: "Decrypt some file with keyphrase",
+	Args:  cobra.MaximumNArgs(1),
 	Run:   decryptFile,
 }
 
@@ -47,6 +60,9 @@ func init() {
 	// is called directly, e.g.:
 	decryptCmd.Flags().StringVarP(&keyphrase, "key", "k", "", "Keyphrase to decrypt file")
 	decryptCmd.Flags().Int32VarP(&bufferSize, "buffer", "b", 1024, "Buffer size")
+	decryptCmd.Flags().BoolVar(&useStdin, "stdin", false, "Read input from stdin (requires --stdout)")
+	decryptCmd.Flags().BoolVar(&useStdout, "stdout", false, "Write output to stdout")
+	decryptCmd.Flags().BoolVar(&legacyFormat, "legacy", false, "Decrypt files without format header as unauthenticated AES-CTR of older versions")
 }
 
 func decryptFile(cmd *cobra.Command, args []string) {
@@ -54,61 +70,106 @@ func decryptFile(cmd *cobra.Command, args []string) {
 	if keyphrase == "" {
 		logrus.Fatalln("Keyphrase is empty!")
 	}
-	keyHash := hashutils.FromKeyToAESKey(keyphrase)
-	logrus.Debugln("keyHash:", keyHash)
 
 	// Input file
-	filename := args[0]
-	infile, err := os.Open(filename)
+	infile, err := openInput(args)
 	if err != nil {
 		logrus.Fatalln(err)
 	}
 	defer infile.Close()
 
-	fi, err := infile.Stat()
+	// Output file
+	outfile, outname, err := createOutput(args, ".dec")
 	if err != nil {
-		log.Fatal(err)
+		logrus.Fatal(err)
 	}
 
-	// Output file
-	outfile, err := os.OpenFile(filename+".dec", os.O_RDWR|os.O_CREATE, 0777)
+	if err := decrypt(infile, outfile, keyphrase, legacyFormat); err != nil {
+		// Never leave unauthenticated plaintext behind
+		outfile.Close()
+		if outname != "" {
+			os.Remove(outname)
+		}
+		logrus.Fatalln(err)
+	}
+	if err := outfile.Close(); err != nil {
+		logrus.Fatalln(err)
+	}
+}
+
+// decrypt writes decrypted and authenticated stream of in to out. It returns
+// cryptoutils.ErrAuthFailed on wrong keyphrase or tampered data. Input without
+// format header fails with ErrUnknownFormat, with allowLegacy it's decrypted
+// as legacy AES-CTR if in is seekable. Legacy files aren't authenticated, so
+// this is never a silent fallback.
+func decrypt(in io.Reader, out io.Writer, keyphrase string, allowLegacy bool) error {
+	r, err := cryptoutils.NewPassphraseReader(in, keyphrase)
+	if errors.Is(err, cryptoutils.ErrUnknownFormat) {
+		if !allowLegacy {
+			return ErrUnknownFormat
+		}
+		rs, ok := in.(io.ReadSeeker)
+		if !ok {
+			return ErrLegacyNotSeekable
+		}
+		return decryptLegacy(rs, out, keyphrase)
+	}
 	if err != nil {
-		logrus.Fatal(err)
+		return err
 	}
-	defer outfile.Close()
+	return copyBuffered(out, r)
+}
+
+// decryptLegacy decrypts unauthenticated AES-CTR file with IV at the end
+func decryptLegacy(in io.ReadSeeker, out io.Writer, keyphrase string) error {
+	logrus.Debugln("No format header, decrypting as legacy AES-CTR")
+	// Legacy files were keyed with plain SHA-256
+	keyHash := hashutils.FromKeyToAESKey(keyphrase)
 
 	// Block Cipher
 	block, err := aes.NewCipher(keyHash)
 	if err != nil {
-		logrus.Fatalln(err)
+		return err
 	}
-	iv := make([]byte, block.BlockSize())
-	logrus.Debugf("BlockSize: %#v\n", block.BlockSize())
-	msgLen := fi.Size() - int64(len(iv))
-	_, err = infile.ReadAt(iv, msgLen)
+	size, err := in.Seek(0, io.SeekEnd)
 	if err != nil {
-		logrus.Fatalln(err)
+		return ErrLegacyNotSeekable
+	}
+	iv := make([]byte, block.BlockSize())
+	msgLen := size - int64(len(iv))
+	if msgLen < 0 {
+		return errors.New("encrypted file is too short")
+	}
+	if _, err := in.Seek(msgLen, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := io.ReadFull(in, iv); err != nil {
+		return err
+	}
+	if _, err := in.Seek(0, io.SeekStart); err != nil {
+		return err
 	}
 
+	stream := cipher.NewCTR(block, iv)
+	return copyBuffered(out, &cipher.StreamReader{S: stream, R: io.LimitReader(in, msgLen)})
+}
+
+// copyBuffered copies in to out with --buffer sized chunks
+func copyBuffered(out io.Writer, in io.Reader) error {
 	// buffer stream
 	buf := make([]byte, bufferSize)
-	stream := cipher.NewCTR(block, iv)
 	for {
-		n, err := infile.Read(buf)
+		n, err := in.Read(buf)
 		if n > 0 {
-			if n > int(msgLen) {
-				n = int(msgLen)
+			if _, err := out.Write(buf[:n]); err != nil {
+				return err
 			}
-			msgLen -= int64(n)
-			stream.XORKeyStream(buf, buf[:n])
-			outfile.Write(buf[:n])
 		}
 		if err == io.EOF {
-			break
+			return nil
 		}
 		if err != nil {
-			logrus.Fatalf("Read %d bytes, err: %v", n, err)
-			break
+			return err
 		}
 	}
 }
@@ -16,13 +16,11 @@ limitations under the License.
 package cmd
 
 import (
-	"crypto/aes"
-	"crypto/cipher"
-	"crypto/rand"
+	"errors"
 	"io"
 	"os"
 
-	"github.com/abrekhov/hypertunnel/pkg/hashutils"
+	"github.com/abrekhov/hypertunnel/pkg/cryptoutils"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
@@ -30,12 +28,15 @@ import (
 var (
 	keyphrase  string
 	bufferSize int32
+	useStdin   bool
+	useStdout  bool
 )
 
 // encryptCmd represents the encrypt command
 var encryptCmd = &cobra.Command{
-	Use:   "encrypt",
-	Short: "Encrypt some file with keyphrase",
+	Use:   "encrypt [file]",
+	Short: "Encrypt some file with keyphrase (AES-256-GCM)",
+	Args:  cobra.MaximumNArgs(1),
 	Run:   EncryptFile,
 }
 
@@ -52,6 +53,8 @@ func init() {
 	// is called directly, e.g.:
 	encryptCmd.Flags().StringVarP(&keyphrase, "key", "k", "", "Keyphrase to encrypt file")
 	encryptCmd.Flags().Int32VarP(&bufferSize, "buffer", "b", 1024, "Buffer size")
+	encryptCmd.Flags().BoolVar(&useStdin, "stdin", false, "Read input from stdin (requires --stdout)")
+	encryptCmd.Flags().BoolVar(&useStdout, "stdout", false, "Write output to stdout")
 }
 
 func EncryptFile(cmd *cobra.Command, args []string) {
@@ -59,51 +62,62 @@ func EncryptFile(cmd *cobra.Command, args []string) {
 	if keyphrase == "" {
 		logrus.Fatalln("Keyphrase is empty!")
 	}
-	keyHash := hashutils.FromKeyToAESKey(keyphrase)
-	logrus.Debugln("keyHash:", keyHash)
 
 	// Input file
-	filename := args[0]
-	infile, err := os.Open(filename)
+	infile, err := openInput(args)
 	if err != nil {
 		logrus.Fatalln(err)
 	}
 	defer infile.Close()
 
 	// Output file
-	outfile, err := os.OpenFile(filename+".enc", os.O_RDWR|os.O_CREATE, 0777)
+	outfile, _, err := createOutput(args, ".enc")
 	if err != nil {
 		logrus.Fatal(err)
 	}
 	defer outfile.Close()
 
-	// Block Cipher
-	block, err := aes.NewCipher(keyHash)
-	if err != nil {
+	if err := encrypt(infile, outfile, keyphrase); err != nil {
 		logrus.Fatalln(err)
 	}
-	iv := make([]byte, block.BlockSize())
-	logrus.Debugf("BlockSize: %#v\n", block.BlockSize())
-	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
-		logrus.Fatalln(err)
+}
+
+// openInput returns stdin with --stdin or the file named by the argument
+func openInput(args []string) (*os.File, error) {
+	if useStdin {
+		return os.Stdin, nil
+	}
+	if len(args) == 0 {
+		return nil, errors.New("file name is required without --stdin")
+	}
+	return os.Open(args[0])
+}
+
+// createOutput returns stdout with --stdout or creates file named by the
+// argument with suffix. Name is empty for stdout.
+func createOutput(args []string, suffix string) (*os.File, string, error) {
+	if useStdout {
+		return os.Stdout, "", nil
+	}
+	if useStdin || len(args) == 0 {
+		return nil, "", errors.New("--stdin requires --stdout")
 	}
+	name := args[0] + suffix
+	fd, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0777)
+	return fd, name, err
+}
 
-	// buffer stream
-	buf := make([]byte, bufferSize)
-	stream := cipher.NewCTR(block, iv)
-	for {
-		n, err := infile.Read(buf)
-		if n > 0 {
-			stream.XORKeyStream(buf, buf[:n])
-			outfile.Write(buf[:n])
-		}
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			logrus.Fatalf("Read %d bytes, err: %v", n, err)
-			break
-		}
+// encrypt writes AES-256-GCM encrypted stream of in to out in
+// cryptoutils.NewPassphraseWriter format, copying --buffer sized chunks.
+// Output starts with format header and random salt for key derivation followed
+// by the stream nonce, so neither side needs to seek.
+func encrypt(in io.Reader, out io.Writer, keyphrase string) error {
+	w, err := cryptoutils.NewPassphraseWriter(out, keyphrase)
+	if err != nil {
+		return err
+	}
+	if err := copyBuffered(w, in); err != nil {
+		return err
 	}
-	outfile.Write(iv)
+	return w.Close()
 }
@@ -0,0 +1,149 @@
+/*
+Copyright © 2021 Anton Brekhov <anton@abrekhov.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/abrekhov/hypertunnel/pkg/cryptoutils"
+	"github.com/abrekhov/hypertunnel/pkg/hashutils"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	plain := bytes.Repeat([]byte("hypertunnel "), 20000)
+	var encrypted bytes.Buffer
+	if err := encrypt(bytes.NewReader(plain), &encrypted, "correct horse"); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(encrypted.Bytes(), []byte("hypertunnel")) {
+		t.Fatal("ciphertext contains plaintext")
+	}
+
+	var decrypted bytes.Buffer
+	if err := decrypt(bytes.NewReader(encrypted.Bytes()), &decrypted, "correct horse", false); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decrypted.Bytes(), plain) {
+		t.Error("decrypted data differs from plaintext")
+	}
+}
+
+func TestDecryptWrongKeyphrase(t *testing.T) {
+	var encrypted bytes.Buffer
+	if err := encrypt(bytes.NewReader([]byte("secret")), &encrypted, "correct horse"); err != nil {
+		t.Fatal(err)
+	}
+	var decrypted bytes.Buffer
+	err := decrypt(bytes.NewReader(encrypted.Bytes()), &decrypted, "battery staple", false)
+	if !errors.Is(err, cryptoutils.ErrAuthFailed) {
+		t.Fatalf("err = %v, want ErrAuthFailed", err)
+	}
+	if decrypted.Len() != 0 {
+		t.Error("plaintext written despite failed authentication")
+	}
+}
+
+func TestDecryptTampered(t *testing.T) {
+	var encrypted bytes.Buffer
+	if err := encrypt(bytes.NewReader([]byte("secret message")), &encrypted, "correct horse"); err != nil {
+		t.Fatal(err)
+	}
+	tampered := encrypted.Bytes()
+	tampered[len(tampered)-20] ^= 0xff
+	err := decrypt(bytes.NewReader(tampered), &bytes.Buffer{}, "correct horse", false)
+	if !errors.Is(err, cryptoutils.ErrAuthFailed) {
+		t.Fatalf("err = %v, want ErrAuthFailed", err)
+	}
+}
+
+func TestEncryptDecryptThroughPipes(t *testing.T) {
+	plain := bytes.Repeat([]byte("streamed "), 30000)
+
+	// plain -> encrypt -> pipe -> decrypt -> out, nothing is seekable
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(encrypt(io.MultiReader(bytes.NewReader(plain)), pw, "pipe key"))
+	}()
+	var out bytes.Buffer
+	if err := decrypt(pr, &out, "pipe key", false); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Bytes(), plain) {
+		t.Error("decrypted data differs from plaintext")
+	}
+}
+
+func TestDecryptLegacyFormat(t *testing.T) {
+	plain := []byte("file encrypted by older ht versions")
+	key := hashutils.FromKeyToAESKey("old key")
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iv := bytes.Repeat([]byte{7}, block.BlockSize())
+	legacy := make([]byte, len(plain))
+	cipher.NewCTR(block, iv).XORKeyStream(legacy, plain)
+	legacy = append(legacy, iv...)
+
+	var out bytes.Buffer
+	if err := decrypt(bytes.NewReader(legacy), &out, "old key", true); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Bytes(), plain) {
+		t.Errorf("decrypted %q, want %q", out.Bytes(), plain)
+	}
+
+	// Without --legacy headerless input is refused, not decrypted into garbage
+	if err := decrypt(bytes.NewReader(legacy), &out, "old key", false); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("err = %v, want ErrUnknownFormat", err)
+	}
+
+	// Legacy IV is at the end, streams can't be decrypted
+	err = decrypt(io.MultiReader(bytes.NewReader(legacy)), &out, "old key", true)
+	if !errors.Is(err, ErrLegacyNotSeekable) {
+		t.Errorf("err = %v, want ErrLegacyNotSeekable", err)
+	}
+}
+
+func TestDecryptCorruptedMagic(t *testing.T) {
+	var encrypted bytes.Buffer
+	if err := encrypt(bytes.NewReader([]byte("secret message")), &encrypted, "correct horse"); err != nil {
+		t.Fatal(err)
+	}
+	corrupted := encrypted.Bytes()
+	corrupted[0] ^= 0xff
+	var out bytes.Buffer
+	err := decrypt(bytes.NewReader(corrupted), &out, "correct horse", false)
+	if !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("err = %v, want ErrUnknownFormat", err)
+	}
+	if out.Len() != 0 {
+		t.Error("output written for corrupted header")
+	}
+}
+
+func TestDecryptUnsupportedVersion(t *testing.T) {
+	data := append([]byte("HTE"), 99)
+	data = append(data, make([]byte, 64)...)
+	if err := decrypt(bytes.NewReader(data), &bytes.Buffer{}, "key", false); err == nil {
+		t.Error("unsupported version accepted")
+	}
+}
@@ -0,0 +1,146 @@
+//go:build integration
+
+/*
+Copyright © 2021 Anton Brekhov <anton@abrekhov.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/abrekhov/hypertunnel/pkg/cryptoutils"
+	"github.com/abrekhov/hypertunnel/pkg/datachannel"
+	"github.com/pion/ice/v2"
+	webrtc "github.com/pion/webrtc/v3"
+)
+
+// newLoopbackSession returns session connecting over loopback only
+func newLoopbackSession(t *testing.T, cfg datachannel.SessionConfig) *datachannel.Session {
+	t.Helper()
+	se := webrtc.SettingEngine{}
+	se.SetIncludeLoopbackCandidate(true)
+	se.SetNetworkTypes([]webrtc.NetworkType{webrtc.NetworkTypeUDP4})
+	se.SetICEMulticastDNSMode(ice.MulticastDNSModeDisabled)
+	s, err := datachannel.NewSession(webrtc.NewAPI(webrtc.WithSettingEngine(se)), webrtc.ICEGatherOptions{}, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// transferEncrypted sends plain as secret.bin with sendPassword through
+// connected sessions and returns what receiver with receivePassword saved
+func transferEncrypted(t *testing.T, plain []byte, sendPassword, receivePassword string) ([]byte, error) {
+	t.Helper()
+	receiverCfg := datachannel.DefaultSessionConfig()
+	receiverCfg.Transfer.AutoAccept = true
+	receiverCfg.Transfer.Filter = func(w io.WriteCloser) io.WriteCloser {
+		return newDecryptingWriter(w, receivePassword)
+	}
+	sender := newLoopbackSession(t, datachannel.DefaultSessionConfig())
+	receiver := newLoopbackSession(t, receiverCfg)
+	senderSignal, err := sender.LocalSignal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	receiverSignal, err := receiver.LocalSignal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		errs[0] = sender.SetRemoteSignal(receiverSignal)
+	}()
+	go func() {
+		defer wg.Done()
+		errs[1] = receiver.SetRemoteSignal(senderSignal)
+	}()
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dest := t.TempDir()
+	received := make(chan error, 1)
+	go func() {
+		received <- receiver.Receive(dest)
+	}()
+	go func() {
+		var r io.Reader = bytes.NewReader(plain)
+		if sendPassword != "" {
+			encrypted := encryptingReader(r, sendPassword)
+			defer encrypted.Close()
+			r = encrypted
+		}
+		// Receiver reports the outcome, sender may fail once it goes away
+		sender.Send("secret.bin", r)
+	}()
+
+	select {
+	case err = <-received:
+	case <-time.After(30 * time.Second):
+		t.Fatal("receive timed out")
+	}
+	receiver.Close()
+	saved, rerr := os.ReadFile(filepath.Join(dest, "secret.bin"))
+	if err == nil && rerr != nil {
+		t.Fatal(rerr)
+	}
+	return saved, err
+}
+
+func TestLoopbackTransferEncrypted(t *testing.T) {
+	plain := make([]byte, 300*1024+5)
+	rand.Read(plain)
+
+	saved, err := transferEncrypted(t, plain, "correct horse", "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(saved, plain) {
+		t.Errorf("saved %d bytes, want %d identical bytes of plaintext", len(saved), len(plain))
+	}
+}
+
+func TestLoopbackTransferEncryptedWrongPassword(t *testing.T) {
+	saved, err := transferEncrypted(t, []byte("secret"), "correct horse", "battery staple")
+	if !errors.Is(err, cryptoutils.ErrAuthFailed) {
+		t.Errorf("err = %v, want ErrAuthFailed", err)
+	}
+	if saved != nil {
+		t.Errorf("saved %q, want no file", saved)
+	}
+}
+
+func TestLoopbackTransferEncryptedSenderWithoutPassword(t *testing.T) {
+	_, err := transferEncrypted(t, []byte("plain"), "", "correct horse")
+	if !errors.Is(err, errNotEncrypted) {
+		t.Errorf("err = %v, want errNotEncrypted", err)
+	}
+}
@@ -0,0 +1,87 @@
+/*
+Copyright © 2021 Anton Brekhov <anton@abrekhov.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"errors"
+	"io"
+
+	"github.com/abrekhov/hypertunnel/pkg/cryptoutils"
+)
+
+// errNotEncrypted is returned by receiver with --password when sender didn't use it
+var errNotEncrypted = errors.New("received data is not encrypted, the sender has to use --password too")
+
+// passwordBufferSize is how much data is encrypted or decrypted at once in
+// transfers with --password, a full segment so every copy seals one
+const passwordBufferSize = cryptoutils.SegmentSize
+
+// encryptingReader returns encrypted stream of r in encrypt command format.
+// Both sides derive the key from password, it's never sent.
+func encryptingReader(r io.Reader, password string) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		w, err := cryptoutils.NewPassphraseWriter(pw, password)
+		if err == nil {
+			_, err = io.CopyBuffer(w, r, make([]byte, passwordBufferSize))
+		}
+		if err == nil {
+			err = w.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+	return pr
+}
+
+// decryptingWriter decrypts stream made by encryptingReader into w as it's
+// written. Close reports wrong password or tampered data.
+type decryptingWriter struct {
+	pw   *io.PipeWriter
+	w    io.WriteCloser
+	done chan error
+}
+
+func newDecryptingWriter(w io.WriteCloser, password string) *decryptingWriter {
+	pr, pw := io.Pipe()
+	d := &decryptingWriter{pw: pw, w: w, done: make(chan error, 1)}
+	go func() {
+		r, err := cryptoutils.NewPassphraseReader(pr, password)
+		if errors.Is(err, cryptoutils.ErrUnknownFormat) {
+			err = errNotEncrypted
+		}
+		if err == nil {
+			_, err = io.CopyBuffer(w, r, make([]byte, passwordBufferSize))
+		}
+		// Keep accepting data after failure, Close reports it
+		io.Copy(io.Discard, pr)
+		d.done <- err
+	}()
+	return d
+}
+
+func (d *decryptingWriter) Write(p []byte) (int, error) {
+	return d.pw.Write(p)
+}
+
+// Close waits for decryption of everything written and closes w
+func (d *decryptingWriter) Close() error {
+	d.pw.Close()
+	err := <-d.done
+	if cerr := d.w.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
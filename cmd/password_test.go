@@ -0,0 +1,55 @@
+/*
+Copyright © 2021 Anton Brekhov <anton@abrekhov.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+// nopCloser is bytes.Buffer closed by the test
+type nopCloser struct {
+	*bytes.Buffer
+}
+
+func (nopCloser) Close() error { return nil }
+
+func TestDecryptingWriterChunked(t *testing.T) {
+	plain := bytes.Repeat([]byte("hypertunnel "), 20000)
+	encrypted, err := io.ReadAll(encryptingReader(bytes.NewReader(plain), "pw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	w := newDecryptingWriter(nopCloser{&out}, "pw")
+	for len(encrypted) > 0 {
+		n := 1000
+		if n > len(encrypted) {
+			n = len(encrypted)
+		}
+		if _, err := w.Write(encrypted[:n]); err != nil {
+			t.Fatal(err)
+		}
+		encrypted = encrypted[n:]
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Bytes(), plain) {
+		t.Error("decrypted data differs from plaintext")
+	}
+}
@@ -0,0 +1,73 @@
+/*
+Copyright © 2021 Anton Brekhov <anton@abrekhov.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// receiveCmd represents the receive command
+var receiveCmd = &cobra.Command{
+	Use:   "receive [dir]",
+	Short: "Receive a file from the peer into dir, the working directory by default",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		cfg, err := receiveConfig(cmd.Flags(), viper.GetViper(), args)
+		if err != nil {
+			return err
+		}
+		return run(cfg)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(receiveCmd)
+	addCommonFlags(receiveCmd.Flags())
+	addReceiveFlags(receiveCmd.Flags())
+}
+
+// receiveConfig is loadConfig with destination directory taken from args
+func receiveConfig(flags *pflag.FlagSet, v *viper.Viper, args []string) (Config, error) {
+	cfg, err := loadConfig(flags, v)
+	if err != nil {
+		return Config{}, err
+	}
+	if cfg.File != "" || cfg.URL != "" {
+		return Config{}, errors.New("ht receive doesn't send, use ht send for --file/--url")
+	}
+	if len(args) == 0 {
+		return cfg, nil
+	}
+	if cfg.Output != "" {
+		return Config{}, errors.New("--output can't be used with a directory")
+	}
+	info, err := os.Stat(args[0])
+	if err != nil {
+		return Config{}, err
+	}
+	if !info.IsDir() {
+		return Config{}, fmt.Errorf("%s is not a directory", args[0])
+	}
+	cfg.Transfer.Dir = args[0]
+	return cfg, nil
+}
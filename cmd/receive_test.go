@@ -0,0 +1,76 @@
+/*
+Copyright © 2021 Anton Brekhov <anton@abrekhov.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestReceiveConfig(t *testing.T) {
+	dir := t.TempDir()
+	flags, args := parseCommandLine(t, []string{dir, "-y", "--force"}, addCommonFlags, addReceiveFlags)
+	cfg, err := receiveConfig(flags, viper.New(), args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Transfer.Dir != dir || !cfg.Transfer.AutoAccept || !cfg.Transfer.Force {
+		t.Errorf("transfer config = %+v, want dir %s with auto-accept and force", cfg.Transfer, dir)
+	}
+
+	flags, args = parseCommandLine(t, []string{"-o", "-"}, addCommonFlags, addReceiveFlags)
+	cfg, err = receiveConfig(flags, viper.New(), args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Transfer.Dir != "" || cfg.Output != "-" {
+		t.Errorf("dir %q, output %q, want working directory and stdout", cfg.Transfer.Dir, cfg.Output)
+	}
+}
+
+func TestReceiveConfigInvalid(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file.txt")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, argv := range [][]string{
+		{filepath.Join(dir, "missing")},
+		{file},
+		{dir, "-o", "-"},
+	} {
+		flags, args := parseCommandLine(t, argv, addCommonFlags, addReceiveFlags)
+		if _, err := receiveConfig(flags, viper.New(), args); err == nil {
+			t.Errorf("receiveConfig(%v) expected error", argv)
+		}
+	}
+}
+
+func TestReceiveFlags(t *testing.T) {
+	for _, name := range []string{"file", "url", "rate", "chunk-size"} {
+		if receiveCmd.Flags().Lookup(name) != nil {
+			t.Errorf("ht receive has sender flag --%s", name)
+		}
+	}
+	for _, name := range []string{"output", "force", "turn"} {
+		if receiveCmd.Flags().Lookup(name) == nil {
+			t.Errorf("ht receive lacks --%s", name)
+		}
+	}
+}
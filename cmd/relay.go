@@ -0,0 +1,55 @@
+/*
+Copyright © 2021 Anton Brekhov <anton@abrekhov.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/abrekhov/hypertunnel/pkg/rendezvous"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	relayListen string
+	relayTTL    time.Duration
+)
+
+// relayCmd represents the relay command
+var relayCmd = &cobra.Command{
+	Use:   "relay",
+	Short: "Run rendezvous relay exchanging signals of peers using --code",
+	Args:  cobra.NoArgs,
+	Run:   runRelay,
+}
+
+func init() {
+	rootCmd.AddCommand(relayCmd)
+
+	relayCmd.Flags().StringVar(&relayListen, "listen", ":8080", "Address to listen on")
+	relayCmd.Flags().DurationVar(&relayTTL, "ttl", rendezvous.DefaultTTL, "How long published signals are kept")
+}
+
+func runRelay(cmd *cobra.Command, args []string) {
+	log.Infof("Relay listening on %s\n", relayListen)
+	server := &http.Server{
+		Addr:              relayListen,
+		Handler:           rendezvous.NewServer(relayTTL),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	log.Fatalln(server.ListenAndServe())
+}
@@ -0,0 +1,94 @@
+/*
+Copyright © 2021 Anton Brekhov <anton@abrekhov.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/abrekhov/hypertunnel/pkg/clipboard"
+	"github.com/abrekhov/hypertunnel/pkg/datachannel"
+	"github.com/abrekhov/hypertunnel/pkg/rendezvous"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// rendezvousTimeout bounds waiting for the peer signal on relay or clipboard
+	rendezvousTimeout = 5 * time.Minute
+	// clipboardPoll is how often clipboard is checked for the peer signal
+	clipboardPoll = 500 * time.Millisecond
+)
+
+// exchangeViaClipboard copies local signal to cb and waits until user copies
+// the signal of the other side
+func exchangeViaClipboard(cb clipboard.Clipboard, local string) (string, error) {
+	if err := cb.Write(local); err != nil {
+		return "", err
+	}
+	log.Infoln("Signal copied to clipboard, now copy the signal of the other side")
+	ctx, cancel := context.WithTimeout(context.Background(), rendezvousTimeout)
+	defer cancel()
+	return clipboard.WaitChange(ctx, cb, local, clipboardPoll)
+}
+
+// printQR prints signal as QR code when stdout is a terminal
+func printQR(signal string) {
+	if info, err := os.Stdout.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		log.Debugln("Stdout is not a terminal, skipping QR code")
+		return
+	}
+	qr, err := datachannel.SignalQR(signal)
+	if err != nil {
+		log.Warnln("Signal doesn't fit QR code:", err)
+		return
+	}
+	fmt.Println(qr)
+}
+
+// exchangeSignal hands local signal to the peer and returns the peer's one,
+// through relay when code is set or copy-pasted by the user otherwise
+func exchangeSignal(cfg Config, local string) (string, error) {
+	if cfg.Code == "" {
+		fmt.Printf("Encoded signal:\n\n")
+		fmt.Println(local)
+		fmt.Printf("\n")
+		if cfg.QR {
+			printQR(local)
+		}
+		if cfg.Clipboard {
+			remote, err := exchangeViaClipboard(clipboard.System(), local)
+			if err == nil {
+				return remote, nil
+			}
+			log.Warnln("Can't use clipboard, paste the signal instead:", err)
+		}
+		return datachannel.ReadSignalFromStdin()
+	}
+
+	client, err := rendezvous.NewClient(cfg.Relay)
+	if err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), rendezvousTimeout)
+	defer cancel()
+	if err := client.Publish(ctx, cfg.Code, local); err != nil {
+		return "", err
+	}
+	log.Infof("Waiting for peer with code %s...\n", cfg.Code)
+	return client.Fetch(ctx, cfg.Code)
+}
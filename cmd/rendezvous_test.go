@@ -0,0 +1,107 @@
+/*
+Copyright © 2021 Anton Brekhov <anton@abrekhov.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"errors"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/abrekhov/hypertunnel/pkg/rendezvous"
+)
+
+func TestExchangeSignalThroughRelay(t *testing.T) {
+	server := httptest.NewServer(rendezvous.NewServer(rendezvous.DefaultTTL))
+	defer server.Close()
+	cfg := Config{Code: "abc123", Relay: server.URL}
+
+	type result struct {
+		signal string
+		err    error
+	}
+	fromSender := make(chan result, 1)
+	go func() {
+		signal, err := exchangeSignal(cfg, "sender-signal")
+		fromSender <- result{signal, err}
+	}()
+	got, err := exchangeSignal(cfg, "receiver-signal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "sender-signal" {
+		t.Errorf("receiver got %q, want sender-signal", got)
+	}
+	res := <-fromSender
+	if res.err != nil {
+		t.Fatal(res.err)
+	}
+	if res.signal != "receiver-signal" {
+		t.Errorf("sender got %q, want receiver-signal", res.signal)
+	}
+}
+
+// fakeClipboard is in-memory clipboard.Clipboard
+type fakeClipboard struct {
+	mu       sync.Mutex
+	text     string
+	writeErr error
+}
+
+func (c *fakeClipboard) Read() (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.text, nil
+}
+
+func (c *fakeClipboard) Write(text string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.writeErr != nil {
+		return c.writeErr
+	}
+	c.text = text
+	return nil
+}
+
+func TestExchangeViaClipboard(t *testing.T) {
+	cb := &fakeClipboard{}
+	go func() {
+		// User copies the peer signal after ours was copied
+		for {
+			if text, _ := cb.Read(); text == "local-signal" {
+				break
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		cb.Write("remote-signal")
+	}()
+	got, err := exchangeViaClipboard(cb, "local-signal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "remote-signal" {
+		t.Errorf("got %q, want remote-signal", got)
+	}
+}
+
+func TestExchangeViaClipboardUnavailable(t *testing.T) {
+	cb := &fakeClipboard{writeErr: errors.New("no clipboard")}
+	if _, err := exchangeViaClipboard(cb, "local-signal"); err == nil {
+		t.Error("expected error without clipboard")
+	}
+}
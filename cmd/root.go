@@ -16,26 +16,32 @@ limitations under the License.
 package cmd
 
 import (
-	"bufio"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/abrekhov/hypertunnel/pkg/datachannel"
-	webrtc "github.com/pion/webrtc/v3"
+	"github.com/abrekhov/hypertunnel/pkg/transfer"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 
 	homedir "github.com/mitchellh/go-homedir"
 	"github.com/spf13/viper"
 )
 
+// estimateAfter is how long the sender measures speed before showing time estimate
+const estimateAfter = 3 * time.Second
+
 // Flags
 var (
-	cfgFile string
-	verbose bool
-	isOffer bool
-	file    string
+	cfgFile  string
+	verbose  bool
+	isSender bool
 )
 
 // rootCmd represents the base command when called without any subcommands
@@ -51,7 +57,9 @@ var rootCmd = &cobra.Command{
 	},
 	// Uncomment the following line if your bare application
 	// has an action associated with it:
-	Run: Connection,
+	RunE: Connection,
+	// Execute prints the error once
+	SilenceErrors: true,
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
@@ -69,7 +77,58 @@ func init() {
 
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.hypertunnel.yaml)")
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Increase verbosity")
-	rootCmd.Flags().StringVarP(&file, "file", "f", "", "File to transfer")
+	addConnectionFlags(rootCmd.Flags())
+}
+
+// addConnectionFlags defines flags assembled into Config by loadConfig. The
+// bare command both sends and receives, so it takes all of them.
+func addConnectionFlags(flags *pflag.FlagSet) {
+	addCommonFlags(flags)
+	addSendFlags(flags)
+	addReceiveFlags(flags)
+}
+
+// addCommonFlags defines flags of connecting to the peer, used by both sides
+func addCommonFlags(flags *pflag.FlagSet) {
+	flags.StringSlice("turn", nil, "TURN server url, e.g. turns:turn.example.com:5349 (repeatable)")
+	flags.String("turn-user", "", "TURN username")
+	flags.String("turn-password", "", "TURN password")
+	flags.String("turn-proxy", "", "Reach TCP/TLS TURN servers through proxy, e.g. socks5://host:1080 or http://host:3128")
+	flags.Int("connect-retries", 0, "Reconnect this many times when connection fails, signals are exchanged again")
+	flags.Duration("connect-timeout", 0, "Give up a connection attempt that takes longer than this (0 waits until it fails)")
+	flags.String("password", "", "Encrypt transfer with AES-256-GCM keyed by this passphrase, both sides must use the same one")
+	flags.String("log-file", "", "Append a JSON line describing every finished transfer to this file")
+	flags.Duration("signal-ttl", 0, "Reject peer signals older than this, e.g. 10m (0 accepts any age)")
+	flags.Bool("no-mdns", false, "Gather plain IP host candidates instead of mDNS .local names and ignore the peer's .local candidates")
+	flags.String("interface", "", "Gather candidates on this network interface only, e.g. eth0")
+	flags.Bool("no-host-candidates", false, "Keep local interface addresses out of the signal, connect through STUN or TURN addresses")
+	flags.Bool("relay-only", false, "Gather TURN relay candidates only, requires --turn")
+	flags.Bool("clipboard", false, "Copy local signal to clipboard and read the peer signal from it")
+	flags.Bool("qr", false, "Print local signal as QR code as well")
+	flags.String("code", "", "Exchange signals automatically through --relay with peer using the same code")
+	flags.String("relay", "", "Rendezvous relay url, e.g. https://relay.example.com (see ht relay)")
+}
+
+// addSendFlags defines flags only the sending side uses
+func addSendFlags(flags *pflag.FlagSet) {
+	flags.StringP("file", "f", "", "File to transfer")
+	flags.String("url", "", "Stream file from http(s) url instead of --file")
+	flags.Int("chunk-size", datachannel.DefaultChunkSize, "Size of sent data messages in bytes, reduced to what the peer accepts")
+	flags.String("rate", "", "Limit send speed per second, e.g. 2MB or 512KiB")
+	flags.Duration("accept-timeout", 0, "Give up when the receiver doesn't accept the file this long (0 waits until it answers)")
+}
+
+// addReceiveFlags defines flags only the receiving side uses
+func addReceiveFlags(flags *pflag.FlagSet) {
+	defaults := datachannel.DefaultConfig()
+	flags.StringP("output", "o", "", "Write received file to stdout with -, prompts and messages go to stderr then")
+	flags.Int("max-connections", defaults.MaxConnections, "Decline incoming data channels beyond this many at once (0 is unlimited)")
+	flags.String("collision-format", string(defaults.CollisionFormat), "Rename received file when name is taken: number (name (1).ext), dot (name.1.ext) or date (name-20060102.ext)")
+	flags.Duration("flush-interval", defaults.FlushInterval, "Write buffered received data to disk at least this often (0 flushes only when buffer is full)")
+	flags.BoolP("auto-accept", "y", defaults.AutoAccept, "Receive files without asking")
+	flags.Bool("force", defaults.Force, "Overwrite existing files without asking")
+	flags.Bool("fsync", defaults.Fsync, "Flush received file to disk before reporting success")
+	flags.Duration("idle-timeout", defaults.IdleTimeout, "Abort when no data flows this long once the file is accepted (0 waits forever)")
 }
 
 // initConfig reads in config file and ENV variables if set.
@@ -87,7 +146,7 @@ func initConfig() {
 		viper.SetConfigName(".hypertunnel")
 	}
 
-	viper.AutomaticEnv() // read in environment variables that match
+	bindEnv(viper.GetViper()) // read in HT_ environment variables that match
 
 	// If a config file is found, read it in.
 	if err := viper.ReadInConfig(); err == nil {
@@ -95,152 +154,142 @@ func initConfig() {
 	}
 }
 
-func Connection(cmd *cobra.Command, args []string) {
+// Connection sends --file or --url, or receives when neither is set
+func Connection(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+	cfg, err := loadConfig(cmd.Flags(), viper.GetViper())
+	if err != nil {
+		return err
+	}
+	return run(cfg)
+}
+
+// run connects to the peer and sends cfg.File or cfg.URL, or receives into
+// cfg.Transfer.Dir when neither is set. Errors are returned rather than
+// exiting so the session and log file get closed.
+func run(cfg Config) error {
+	limiter := transfer.NewRateLimiter(cfg.RateLimit)
+	file, srcURL := cfg.File, cfg.URL
+	name, err := sourceName(file, srcURL)
+	if err != nil {
+		return err
+	}
 
 	// Who receiver and who sender?
-	if file == "" {
-		isOffer = false
+	if file == "" && srcURL == "" {
+		isSender = false
 		log.Infoln("Receiver started...")
+	} else if srcURL != "" {
+		isSender = true
+		log.Infoln("Sender started, streaming", srcURL)
 	} else {
-		isOffer = true
+		isSender = true
 		info, err := os.Stat(file)
-		if os.IsNotExist(err) {
-			log.Panicln("File does not exist.")
+		if err != nil {
+			return err
 		}
 		if info.IsDir() {
-			log.Panicln("Directory is not yet supported")
+			return errors.New("directory is not yet supported")
 		} else {
 			log.Infoln("Sender started...")
 			log.Debugf("Fileinfo: %#v\n", info)
 		}
 	}
-	// Prepare ICE gathering options
-	iceOptions := webrtc.ICEGatherOptions{
-		ICEServers: []webrtc.ICEServer{
-			{URLs: []string{"stun:stun.l.google.com:19302"}},
-		},
+	if cfg.Output == "-" {
+		stdout := os.Stdout
+		// Messages and prompts go to stderr, stdout carries the file only
+		os.Stdout = os.Stderr
+		cfg.Transfer.Sink = datachannel.WriterSink{W: stdout}
+		cfg.Transfer.MaxConnections = 1
 	}
-	// Create an API object
-	api := webrtc.NewAPI()
-	// Create the ICE gatherer
-	gatherer, err := api.NewICEGatherer(iceOptions)
-	cobra.CheckErr(err)
-	// Construct the ICE transport
-	ice := api.NewICETransport(gatherer)
-	// Construct the DTLS transport
-	dtls, err := api.NewDTLSTransport(ice, nil)
-	cobra.CheckErr(err)
-	// Construct the SCTP transport
-	sctp := api.NewSCTPTransport(dtls)
-	log.Debugf("SCTP: %#v\n", sctp)
-
-	// Handle incoming data channels (receiver)
-	sctp.OnDataChannel(datachannel.FileTransferHandler)
-	gatherFinished := make(chan struct{})
-	gatherer.OnLocalCandidate(func(i *webrtc.ICECandidate) {
-		if i == nil {
-			close(gatherFinished)
+	if cfg.Password != "" {
+		cfg.Transfer.Filter = func(w io.WriteCloser) io.WriteCloser {
+			return newDecryptingWriter(w, cfg.Password)
 		}
-	})
-
-	// Gather candidates
-	err = gatherer.Gather()
-	cobra.CheckErr(err)
-
-	<-gatherFinished
-	iceCandidates, err := gatherer.GetLocalCandidates()
-	cobra.CheckErr(err)
-
-	iceParams, err := gatherer.GetLocalParameters()
-	cobra.CheckErr(err)
-
-	dtlsParams, err := dtls.GetLocalParameters()
-	cobra.CheckErr(err)
-
-	sctpCapabilities := sctp.GetCapabilities()
-
-	s := datachannel.Signal{
-		ICECandidates:    iceCandidates,
-		ICEParameters:    iceParams,
-		DTLSParameters:   dtlsParams,
-		SCTPCapabilities: sctpCapabilities,
 	}
-	// Exchange the information
-	fmt.Printf("Encoded signal:\n\n")
-	fmt.Println(datachannel.Encode(s))
-	fmt.Printf("\n")
-
-	// Waiting for encoded signal from other side
-	remoteSignal := datachannel.Signal{}
-	datachannel.Decode(datachannel.MustReadStdin(), &remoteSignal)
-
-	iceRole := webrtc.ICERoleControlled
-	if isOffer {
-		iceRole = webrtc.ICERoleControlling
+	var summary io.Writer
+	if cfg.LogFile != "" {
+		// O_APPEND keeps lines of concurrent ht runs whole
+		f, err := os.OpenFile(cfg.LogFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		summary = f
+		cfg.Transfer.Summary = f
 	}
-	err = ice.SetRemoteCandidates(remoteSignal.ICECandidates)
-	cobra.CheckErr(err)
-
-	log.Debugln("Start ICE TR")
-	// Start the ICE transport
-	err = ice.Start(gatherer, remoteSignal.ICEParameters, &iceRole)
-	cobra.CheckErr(err)
-
-	log.Debugln("Start DTLS")
-	// Start the DTLS transport
-	err = dtls.Start(remoteSignal.DTLSParameters)
-	cobra.CheckErr(err)
-
-	log.Debugln("Start SCTP")
-	// Start the SCTP transport
-	err = sctp.Start(remoteSignal.SCTPCapabilities)
-	cobra.CheckErr(err)
-	// Construct the data channel as the offerer
-	if isOffer {
-		var id uint16 = 1
-		info, err := os.Stat(file)
-		cobra.CheckErr(err)
-
-		dcParams := &webrtc.DataChannelParameters{
-			Label:   info.Name(),
-			ID:      &id,
-			Ordered: true,
+	// logSent records transfer of the sender, receiver records its own
+	var started time.Time
+	logSent := func(size int64, err error) {
+		if summary == nil || !isSender {
+			return
 		}
-		// log.Debugf("%#v\n", dcParams)
-		log.Debugf("Fileinfo: %#v\n", info)
-		var channel *webrtc.DataChannel
-		channel, err = api.NewDataChannel(sctp, dcParams)
-		cobra.CheckErr(err)
+		status := &transfer.Status{Filename: filepath.Base(name), Size: size, Started: started, Finished: time.Now(), Err: err}
+		if err := transfer.WriteSummary(summary, status); err != nil {
+			log.Warnln("Failed to write transfer summary:", err)
+		}
+	}
+	session, err := connect(cfg)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	started = time.Now()
 
-		var fd *os.File
-		channel.OnOpen(func() {
-			fd, err := os.Open(file)
-			cobra.CheckErr(err)
-			r := bufio.NewReader(fd)
-			chunk := make([]byte, 65534)
-			for {
-				nbytes, err := r.Read(chunk)
-				log.Debugln("nbytes:", nbytes)
-				if err != nil {
-					<-time.After(time.Second * 30)
-					break
-				}
-				err = channel.Send(chunk[:nbytes])
-				if err != nil {
-					log.Debugln(err)
-				}
-			}
-			// err = fd.Close()
-			// cobra.CheckErr(err)
-			// channel.Close()
-		})
-		channel.OnClose(func() {
-			fmt.Printf("Ready state of channel: %s", channel.ReadyState().String())
-			fmt.Printf("Chunks from DataChannel '%s' transfered.\n", channel.Label())
-			os.Exit(0)
-		})
-		defer fd.Close()
+	if !isSender {
+		if err := session.Receive(cfg.Transfer.Dir); err != nil {
+			return fmt.Errorf("transfer failed: %w", err)
+		}
+		return nil
 	}
+	// Source is opened once the receiver accepted, URLs aren't fetched before
+	src := &lazyReader{open: func() (io.ReadCloser, error) {
+		src, size, err := openSource(http.DefaultClient, file, srcURL)
+		if err != nil {
+			return nil, err
+		}
+		r := &sourceReader{
+			Reader:  &estimateReader{r: limiter.Reader(src), size: size, start: time.Now()},
+			closers: []io.Closer{src},
+		}
+		if cfg.Password != "" {
+			encrypted := encryptingReader(r.Reader, cfg.Password)
+			r.Reader = encrypted
+			r.closers = append([]io.Closer{encrypted}, r.closers...)
+		}
+		return r, nil
+	}}
+	// Send may return before its reads stop, src closes what's opened
+	// either way and refuses to open later
+	n, err := session.Send(filepath.Base(name), src)
+	src.Close()
+	logSent(n, err)
+	if err != nil {
+		return fmt.Errorf("transfer failed: %w", err)
+	}
+	log.Infof("Sent %s\n", transfer.FormatSize(n))
+	return nil
+}
 
-	select {}
+// estimateReader logs once how long the rest of the file takes at current speed
+type estimateReader struct {
+	r         io.Reader
+	size      int64
+	read      int64
+	start     time.Time
+	estimated bool
+}
+
+func (er *estimateReader) Read(p []byte) (int, error) {
+	n, err := er.r.Read(p)
+	er.read += int64(n)
+	// Speed settles after a few seconds, show the estimate once
+	if elapsed := time.Since(er.start); !er.estimated && elapsed > estimateAfter {
+		er.estimated = true
+		speed := float64(er.read) / elapsed.Seconds()
+		if eta := transfer.EstimateDuration(er.size-er.read, speed); eta > 0 {
+			log.Infof("~%s left at current speed\n", eta)
+		}
+	}
+	return n, err
 }
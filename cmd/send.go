@@ -0,0 +1,63 @@
+/*
+Copyright © 2021 Anton Brekhov <anton@abrekhov.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"errors"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// sendCmd represents the send command
+var sendCmd = &cobra.Command{
+	Use:   "send [path]",
+	Short: "Send a file, or stream --url, to the peer running ht receive",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		cfg, err := sendConfig(cmd.Flags(), viper.GetViper(), args)
+		if err != nil {
+			return err
+		}
+		return run(cfg)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(sendCmd)
+	addCommonFlags(sendCmd.Flags())
+	addSendFlags(sendCmd.Flags())
+}
+
+// sendConfig is loadConfig with the sent path taken from args
+func sendConfig(flags *pflag.FlagSet, v *viper.Viper, args []string) (Config, error) {
+	cfg, err := loadConfig(flags, v)
+	if err != nil {
+		return Config{}, err
+	}
+	if len(args) == 1 {
+		if cfg.File != "" || cfg.URL != "" {
+			return Config{}, errors.New("pass the path either as argument or with --file/--url")
+		}
+		cfg.File = args[0]
+	}
+	if cfg.File == "" && cfg.URL == "" {
+		return Config{}, errors.New("nothing to send, pass a path or --url")
+	}
+	return cfg, nil
+}
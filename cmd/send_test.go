@@ -0,0 +1,101 @@
+/*
+Copyright © 2021 Anton Brekhov <anton@abrekhov.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// parseCommandLine parses argv with flags defined by add, like ht send and
+// receive do, returning flags and positional arguments
+func parseCommandLine(t *testing.T, argv []string, add ...func(*pflag.FlagSet)) (*pflag.FlagSet, []string) {
+	t.Helper()
+	flags := pflag.NewFlagSet("ht", pflag.ContinueOnError)
+	for _, add := range add {
+		add(flags)
+	}
+	if err := flags.Parse(argv); err != nil {
+		t.Fatal(err)
+	}
+	return flags, flags.Args()
+}
+
+func TestSendConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		argv     []string
+		wantFile string
+		wantURL  string
+	}{
+		{"path argument", []string{"report.pdf", "--chunk-size", "16384"}, "report.pdf", ""},
+		{"file flag", []string{"-f", "report.pdf"}, "report.pdf", ""},
+		{"url flag", []string{"--url", "https://example.com/a.iso"}, "", "https://example.com/a.iso"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flags, args := parseCommandLine(t, tt.argv, addCommonFlags, addSendFlags)
+			cfg, err := sendConfig(flags, viper.New(), args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.File != tt.wantFile || cfg.URL != tt.wantURL {
+				t.Errorf("file %q, url %q, want %q and %q", cfg.File, cfg.URL, tt.wantFile, tt.wantURL)
+			}
+		})
+	}
+
+	flags, args := parseCommandLine(t, []string{"report.pdf", "--chunk-size", "16384", "--accept-timeout", "5m"}, addCommonFlags, addSendFlags)
+	cfg, err := sendConfig(flags, viper.New(), args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.ChunkSize != 16384 || cfg.AcceptTimeout != 5*time.Minute {
+		t.Errorf("chunk size %d, accept timeout %s, want flag values", cfg.ChunkSize, cfg.AcceptTimeout)
+	}
+}
+
+func TestSendConfigInvalid(t *testing.T) {
+	for _, argv := range [][]string{
+		{},
+		{"a.txt", "--file", "b.txt"},
+		{"a.txt", "--url", "https://example.com/b.txt"},
+	} {
+		flags, args := parseCommandLine(t, argv, addCommonFlags, addSendFlags)
+		if _, err := sendConfig(flags, viper.New(), args); err == nil {
+			t.Errorf("sendConfig(%v) expected error", argv)
+		}
+	}
+}
+
+func TestSendFlags(t *testing.T) {
+	if err := sendCmd.Args(sendCmd, []string{"a.txt", "b.txt"}); err == nil {
+		t.Error("ht send accepted two paths")
+	}
+	for _, name := range []string{"output", "force", "collision-format"} {
+		if sendCmd.Flags().Lookup(name) != nil {
+			t.Errorf("ht send has receiver flag --%s", name)
+		}
+	}
+	for _, name := range []string{"file", "chunk-size", "turn"} {
+		if sendCmd.Flags().Lookup(name) == nil {
+			t.Errorf("ht send lacks --%s", name)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+/*
+Copyright © 2021 Anton Brekhov <anton@abrekhov.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sync"
+)
+
+// defaultURLFileName names files from URLs without a file name in the path
+const defaultURLFileName = "download"
+
+// sourceName returns name the receiver saves the sent file as
+func sourceName(file, rawURL string) (string, error) {
+	if rawURL == "" {
+		return file, nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("unsupported url scheme %q, use http or https", u.Scheme)
+	}
+	name := path.Base(u.Path)
+	if name == "/" || name == "." {
+		name = defaultURLFileName
+	}
+	return name, nil
+}
+
+// openSource opens file or, with rawURL, response body of GET request. Size is
+// -1 when server doesn't send Content-Length.
+func openSource(client *http.Client, file, rawURL string) (io.ReadCloser, int64, error) {
+	if rawURL == "" {
+		fd, err := os.Open(file)
+		if err != nil {
+			return nil, 0, err
+		}
+		info, err := fd.Stat()
+		if err != nil {
+			fd.Close()
+			return nil, 0, err
+		}
+		return fd, info.Size(), nil
+	}
+	resp, err := client.Get(rawURL)
+	if err != nil {
+		return nil, 0, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		resp.Body.Close()
+		return nil, 0, fmt.Errorf("GET %s: %s", rawURL, resp.Status)
+	}
+	return resp.Body, resp.ContentLength, nil
+}
+
+// sourceReader reads sent data and closes everything it's read through
+type sourceReader struct {
+	io.Reader
+	closers []io.Closer
+}
+
+// Close closes readers in order, outer ones first
+func (sr *sourceReader) Close() error {
+	var errs []error
+	for _, c := range sr.closers {
+		errs = append(errs, c.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// lazyReader calls open on first Read and reads what it returned. It owns the
+// opened reader: Close closes it, also while Read runs in another goroutine,
+// and Reads after Close fail instead of opening.
+type lazyReader struct {
+	open   func() (io.ReadCloser, error)
+	mu     sync.Mutex
+	r      io.ReadCloser
+	closed bool
+}
+
+func (lr *lazyReader) Read(p []byte) (int, error) {
+	lr.mu.Lock()
+	if lr.r == nil {
+		if lr.closed {
+			lr.mu.Unlock()
+			return 0, os.ErrClosed
+		}
+		r, err := lr.open()
+		if err != nil {
+			lr.mu.Unlock()
+			return 0, err
+		}
+		lr.r = r
+	}
+	r := lr.r
+	lr.mu.Unlock()
+	return r.Read(p)
+}
+
+// Close closes the opened reader, if any
+func (lr *lazyReader) Close() error {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	lr.closed = true
+	if lr.r == nil {
+		return nil
+	}
+	return lr.r.Close()
+}
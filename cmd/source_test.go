@@ -0,0 +1,158 @@
+/*
+Copyright © 2021 Anton Brekhov <anton@abrekhov.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+)
+
+func TestSourceName(t *testing.T) {
+	tests := []struct {
+		file, url string
+		want      string
+		wantErr   bool
+	}{
+		{"dir/report.pdf", "", "dir/report.pdf", false},
+		{"", "https://example.com/files/report.pdf?token=1", "report.pdf", false},
+		{"", "http://example.com/", defaultURLFileName, false},
+		{"", "http://example.com", defaultURLFileName, false},
+		{"", "ftp://example.com/report.pdf", "", true},
+	}
+	for _, tt := range tests {
+		got, err := sourceName(tt.file, tt.url)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("sourceName(%q, %q) err = %v, wantErr %v", tt.file, tt.url, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("sourceName(%q, %q) = %q, want %q", tt.file, tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestOpenSourceURL(t *testing.T) {
+	payload := bytes.Repeat([]byte("hypertunnel"), 10000)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/file.bin":
+			w.Header().Set("Content-Length", strconv.Itoa(len(payload)))
+			w.Write(payload)
+		case "/chunked.bin":
+			// Flushing before the end makes the response chunked, without length
+			w.Write(payload[:100])
+			w.(http.Flusher).Flush()
+			w.Write(payload[100:])
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	for path, wantSize := range map[string]int64{"/file.bin": int64(len(payload)), "/chunked.bin": -1} {
+		src, size, err := openSource(server.Client(), "", server.URL+path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(src)
+		src.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if size != wantSize {
+			t.Errorf("%s size = %d, want %d", path, size, wantSize)
+		}
+		if !bytes.Equal(got, payload) {
+			t.Errorf("%s streamed %d bytes, want %d", path, len(got), len(payload))
+		}
+	}
+
+	if _, _, err := openSource(server.Client(), "", server.URL+"/missing"); err == nil {
+		t.Error("expected error for 404 response")
+	}
+}
+
+func TestLazyReaderOpensOnRead(t *testing.T) {
+	opened := 0
+	lr := &lazyReader{open: func() (io.ReadCloser, error) {
+		opened++
+		return io.NopCloser(bytes.NewReader([]byte("deferred"))), nil
+	}}
+	if opened != 0 {
+		t.Fatal("opened before read")
+	}
+	got, err := io.ReadAll(lr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "deferred" || opened != 1 {
+		t.Errorf("read %q, opened %d times", got, opened)
+	}
+}
+
+// closeRecorder is io.ReadCloser recording Close
+type closeRecorder struct {
+	io.Reader
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestLazyReaderClose(t *testing.T) {
+	src := &closeRecorder{Reader: bytes.NewReader([]byte("data"))}
+	lr := &lazyReader{open: func() (io.ReadCloser, error) {
+		return src, nil
+	}}
+	if _, err := lr.Read(make([]byte, 1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := lr.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !src.closed {
+		t.Error("opened reader not closed")
+	}
+
+	// Sender gave up before reading, nothing may be opened afterwards
+	lr = &lazyReader{open: func() (io.ReadCloser, error) {
+		t.Error("opened after Close")
+		return src, nil
+	}}
+	lr.Close()
+	if _, err := lr.Read(make([]byte, 1)); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("read after Close: err = %v, want os.ErrClosed", err)
+	}
+}
+
+func TestSourceReaderClose(t *testing.T) {
+	inner, outer := &closeRecorder{}, &closeRecorder{}
+	sr := &sourceReader{Reader: outer, closers: []io.Closer{outer, inner}}
+	if err := sr.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !inner.closed || !outer.closed {
+		t.Errorf("closed inner %v, outer %v, want both", inner.closed, outer.closed)
+	}
+}
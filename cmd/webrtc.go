@@ -0,0 +1,240 @@
+/*
+Copyright © 2021 Anton Brekhov <anton@abrekhov.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pion/ice/v2"
+	webrtc "github.com/pion/webrtc/v3"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/proxy"
+)
+
+// defaultSTUNServer is used to gather server reflexive candidates
+const defaultSTUNServer = "stun:stun.l.google.com:19302"
+
+// newWebRTCAPI builds API and gathering options with turn servers. With
+// network.NoMDNS host candidates carry IP addresses and remote .local names
+// aren't resolved.
+func newWebRTCAPI(turn TURNConfig, network NetworkConfig) (*webrtc.API, webrtc.ICEGatherOptions, error) {
+	servers, err := iceServers(turn.URLs, turn.User, turn.Password)
+	if err != nil {
+		return nil, webrtc.ICEGatherOptions{}, err
+	}
+	se := webrtc.SettingEngine{}
+	if network.NoMDNS {
+		se.SetICEMulticastDNSMode(ice.MulticastDNSModeDisabled)
+	}
+	if network.Interface != "" {
+		if _, err := net.InterfaceByName(network.Interface); err != nil {
+			return nil, webrtc.ICEGatherOptions{}, fmt.Errorf("--interface %s: %w", network.Interface, err)
+		}
+		se.SetInterfaceFilter(interfaceFilter(network.Interface))
+	}
+	options := webrtc.ICEGatherOptions{ICEServers: servers}
+	if network.RelayOnly {
+		options.ICEGatherPolicy = webrtc.ICETransportPolicyRelay
+	}
+	if turn.Proxy != "" {
+		dialer, err := turnProxyDialer(turn.Proxy, turn.URLs)
+		if err != nil {
+			return nil, webrtc.ICEGatherOptions{}, err
+		}
+		se.SetICEProxyDialer(dialer)
+	}
+	return webrtc.NewAPI(webrtc.WithSettingEngine(se)), options, nil
+}
+
+// interfaceFilter returns gatherer interface filter accepting interface name only
+func interfaceFilter(name string) func(string) bool {
+	return func(iface string) bool {
+		return iface == name
+	}
+}
+
+// candidateFilter returns which gathered candidates go into the local signal,
+// nil keeps all of them. Host candidates are still used for connectivity
+// checks, they just aren't advertised.
+func candidateFilter(network NetworkConfig) func(webrtc.ICECandidate) bool {
+	if !network.NoHostCandidates {
+		return nil
+	}
+	return func(c webrtc.ICECandidate) bool {
+		return c.Typ != webrtc.ICECandidateTypeHost
+	}
+}
+
+// iceServers returns default STUN server and TURN servers from urls.
+// "turns://host:port" form is accepted as well as "turns:host:port".
+func iceServers(urls []string, username, credential string) ([]webrtc.ICEServer, error) {
+	servers := []webrtc.ICEServer{{URLs: []string{defaultSTUNServer}}}
+	if len(urls) == 0 {
+		return servers, nil
+	}
+	turn := webrtc.ICEServer{
+		Username:       username,
+		Credential:     credential,
+		CredentialType: webrtc.ICECredentialTypePassword,
+	}
+	for _, raw := range urls {
+		if _, err := parseTURNURL(raw); err != nil {
+			return nil, err
+		}
+		turn.URLs = append(turn.URLs, normalizeICEURL(raw))
+	}
+	return append(servers, turn), nil
+}
+
+// parseTURNURL parses turn: or turns: url
+func parseTURNURL(raw string) (*ice.URL, error) {
+	u, err := ice.ParseURL(normalizeICEURL(raw))
+	if err != nil {
+		return nil, fmt.Errorf("invalid TURN url %q: %w", raw, err)
+	}
+	if u.Scheme != ice.SchemeTypeTURN && u.Scheme != ice.SchemeTypeTURNS {
+		return nil, fmt.Errorf("invalid TURN url %q: scheme must be turn or turns", raw)
+	}
+	return u, nil
+}
+
+// normalizeICEURL turns "turns://host" into "turns:host" expected by pion
+func normalizeICEURL(raw string) string {
+	for _, scheme := range []string{"stun", "stuns", "turn", "turns"} {
+		if strings.HasPrefix(raw, scheme+"://") {
+			return scheme + ":" + strings.TrimPrefix(raw, scheme+"://")
+		}
+	}
+	return raw
+}
+
+// turnProxyDialer returns dialer reaching TCP TURN servers through socks5:// or
+// http:// proxy. pion hands proxied connections to the TURN client as is, so
+// connections to turns: servers are wrapped in TLS here.
+func turnProxyDialer(rawProxy string, urls []string) (proxy.Dialer, error) {
+	proxyURL, err := url.Parse(rawProxy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy url %q: %w", rawProxy, err)
+	}
+	var dialer proxy.Dialer
+	switch proxyURL.Scheme {
+	case "socks5", "socks5h":
+		dialer, err = proxy.FromURL(proxyURL, proxy.Direct)
+		if err != nil {
+			return nil, err
+		}
+	case "http":
+		dialer = &httpConnectDialer{proxyURL: proxyURL, forward: proxy.Direct}
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q, use socks5 or http", proxyURL.Scheme)
+	}
+
+	tlsHosts := map[string]string{}
+	for _, raw := range urls {
+		u, err := parseTURNURL(raw)
+		if err != nil {
+			return nil, err
+		}
+		if u.Proto != ice.ProtoTypeTCP {
+			log.Warnf("TURN server %s uses UDP and bypasses the proxy, add ?transport=tcp\n", raw)
+		}
+		if u.Scheme == ice.SchemeTypeTURNS {
+			// Same address format pion uses when dialing
+			tlsHosts[fmt.Sprintf("%s:%d", u.Host, u.Port)] = u.Host
+		}
+	}
+	return &turnsDialer{forward: dialer, tlsHosts: tlsHosts}, nil
+}
+
+// turnsDialer wraps connections to turns: servers in TLS
+type turnsDialer struct {
+	forward  proxy.Dialer
+	tlsHosts map[string]string
+}
+
+func (d *turnsDialer) Dial(network, addr string) (net.Conn, error) {
+	conn, err := d.forward.Dial(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	serverName, ok := d.tlsHosts[addr]
+	if !ok {
+		return conn, nil
+	}
+	tlsConn := tls.Client(conn, &tls.Config{ServerName: serverName})
+	if err := tlsConn.Handshake(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// httpConnectDialer tunnels TCP connections through HTTP proxy with CONNECT
+type httpConnectDialer struct {
+	proxyURL *url.URL
+	forward  proxy.Dialer
+}
+
+func (d *httpConnectDialer) Dial(network, addr string) (net.Conn, error) {
+	conn, err := d.forward.Dial("tcp", d.proxyURL.Host)
+	if err != nil {
+		return nil, err
+	}
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if user := d.proxyURL.User; user != nil {
+		password, _ := user.Password()
+		auth := base64.StdEncoding.EncodeToString([]byte(user.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+auth)
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("proxy refused CONNECT to %s: %s", addr, resp.Status)
+	}
+	return &bufferedConn{Conn: conn, r: br}, nil
+}
+
+// bufferedConn reads data the proxy sent right after its response first
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
@@ -0,0 +1,171 @@
+/*
+Copyright © 2021 Anton Brekhov <anton@abrekhov.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"reflect"
+	"testing"
+
+	webrtc "github.com/pion/webrtc/v3"
+)
+
+func TestICEServersTURN(t *testing.T) {
+	servers, err := iceServers([]string{
+		"turns://turn.example.com:5349",
+		"turn:turn.example.com:3478?transport=tcp",
+	}, "user", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []webrtc.ICEServer{
+		{URLs: []string{defaultSTUNServer}},
+		{
+			URLs:           []string{"turns:turn.example.com:5349", "turn:turn.example.com:3478?transport=tcp"},
+			Username:       "user",
+			Credential:     "secret",
+			CredentialType: webrtc.ICECredentialTypePassword,
+		},
+	}
+	if !reflect.DeepEqual(servers, want) {
+		t.Errorf("iceServers = %#v, want %#v", servers, want)
+	}
+}
+
+func TestICEServersInvalid(t *testing.T) {
+	for _, raw := range []string{"http://turn.example.com", "stun:stun.example.com:3478", "turn:"} {
+		if _, err := iceServers([]string{raw}, "", ""); err == nil {
+			t.Errorf("iceServers(%q) accepted invalid TURN url", raw)
+		}
+	}
+}
+
+func TestTURNProxyDialer(t *testing.T) {
+	dialer, err := turnProxyDialer("socks5://127.0.0.1:1080", []string{"turns:turn.example.com:5349"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	td, ok := dialer.(*turnsDialer)
+	if !ok {
+		t.Fatalf("dialer is %T, want *turnsDialer", dialer)
+	}
+	if td.tlsHosts["turn.example.com:5349"] != "turn.example.com" {
+		t.Errorf("turns server not wrapped in TLS: %v", td.tlsHosts)
+	}
+
+	if _, err := turnProxyDialer("http://proxy.example.com:3128", nil); err != nil {
+		t.Errorf("http proxy rejected: %v", err)
+	}
+	if _, err := turnProxyDialer("ftp://proxy.example.com", nil); err == nil {
+		t.Error("ftp proxy accepted")
+	}
+}
+
+func TestHTTPConnectDialer(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	// Fake proxy accepting CONNECT and echoing the tunnel
+	requests := make(chan *http.Request, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		br := bufio.NewReader(conn)
+		req, err := http.ReadRequest(br)
+		if err != nil {
+			return
+		}
+		requests <- req
+		io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+		io.Copy(conn, br)
+	}()
+
+	dialer, err := turnProxyDialer("http://alice:pw@"+ln.Addr().String(), []string{"turn:turn.example.com:3478?transport=tcp"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := dialer.Dial("tcp4", "turn.example.com:3478")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	req := <-requests
+	if req.Method != http.MethodConnect || req.Host != "turn.example.com:3478" {
+		t.Errorf("proxy got %s %s, want CONNECT turn.example.com:3478", req.Method, req.Host)
+	}
+	if got := req.Header.Get("Proxy-Authorization"); got != "Basic YWxpY2U6cHc=" {
+		t.Errorf("Proxy-Authorization = %q", got)
+	}
+
+	io.WriteString(conn, "ping")
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "ping" {
+		t.Errorf("tunnel echo = %q, %v", buf, err)
+	}
+}
+
+func TestInterfaceFilter(t *testing.T) {
+	filter := interfaceFilter("eth0")
+	for iface, want := range map[string]bool{"eth0": true, "eth1": false, "tun0": false, "": false} {
+		if got := filter(iface); got != want {
+			t.Errorf("filter(%q) = %v, want %v", iface, got, want)
+		}
+	}
+}
+
+func TestCandidateFilter(t *testing.T) {
+	if candidateFilter(NetworkConfig{}) != nil {
+		t.Error("filter set without --no-host-candidates")
+	}
+	filter := candidateFilter(NetworkConfig{NoHostCandidates: true})
+	for typ, want := range map[webrtc.ICECandidateType]bool{
+		webrtc.ICECandidateTypeHost:  false,
+		webrtc.ICECandidateTypeSrflx: true,
+		webrtc.ICECandidateTypePrflx: true,
+		webrtc.ICECandidateTypeRelay: true,
+	} {
+		if got := filter(webrtc.ICECandidate{Typ: typ}); got != want {
+			t.Errorf("filter(%s) = %v, want %v", typ, got, want)
+		}
+	}
+}
+
+func TestNewWebRTCAPIUnknownInterface(t *testing.T) {
+	if _, _, err := newWebRTCAPI(TURNConfig{}, NetworkConfig{Interface: "no-such-interface0"}); err == nil {
+		t.Error("expected error for unknown interface")
+	}
+}
+
+func TestNewWebRTCAPIRelayOnly(t *testing.T) {
+	turn := TURNConfig{URLs: []string{"turn:turn.example.com:3478"}}
+	_, options, err := newWebRTCAPI(turn, NetworkConfig{RelayOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if options.ICEGatherPolicy != webrtc.ICETransportPolicyRelay {
+		t.Errorf("gather policy = %s, want relay", options.ICEGatherPolicy)
+	}
+}
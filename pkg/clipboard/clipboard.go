@@ -0,0 +1,65 @@
+/*
+ *   Copyright (c) 2021 Anton Brekhov
+ *   All rights reserved.
+ */
+
+// Package clipboard wraps system clipboard so it can be replaced in tests
+package clipboard
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/atotto/clipboard"
+)
+
+// ErrUnavailable is returned when system has no clipboard, e.g. headless
+// Linux without xclip, xsel or wl-clipboard
+var ErrUnavailable = errors.New("clipboard is not available")
+
+// Clipboard reads and writes text
+type Clipboard interface {
+	Read() (string, error)
+	Write(text string) error
+}
+
+// System returns clipboard of the OS
+func System() Clipboard {
+	return systemClipboard{}
+}
+
+type systemClipboard struct{}
+
+func (systemClipboard) Read() (string, error) {
+	if clipboard.Unsupported {
+		return "", ErrUnavailable
+	}
+	return clipboard.ReadAll()
+}
+
+func (systemClipboard) Write(text string) error {
+	if clipboard.Unsupported {
+		return ErrUnavailable
+	}
+	return clipboard.WriteAll(text)
+}
+
+// WaitChange polls cb every interval until it holds non-empty text other than
+// previous, i.e. until user copied something new
+func WaitChange(ctx context.Context, cb Clipboard, previous string, interval time.Duration) (string, error) {
+	for {
+		text, err := cb.Read()
+		if err != nil {
+			return "", err
+		}
+		if text != "" && text != previous {
+			return text, nil
+		}
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
@@ -0,0 +1,60 @@
+/*
+ *   Copyright (c) 2021 Anton Brekhov
+ *   All rights reserved.
+ */
+package clipboard
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClipboard is in-memory Clipboard
+type fakeClipboard struct {
+	mu   sync.Mutex
+	text string
+}
+
+func (c *fakeClipboard) Read() (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.text, nil
+}
+
+func (c *fakeClipboard) Write(text string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.text = text
+	return nil
+}
+
+func TestWaitChange(t *testing.T) {
+	cb := &fakeClipboard{}
+	cb.Write("local-signal")
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		cb.Write("remote-signal")
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	got, err := WaitChange(ctx, cb, "local-signal", 5*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "remote-signal" {
+		t.Errorf("got %q, want remote-signal", got)
+	}
+}
+
+func TestWaitChangeTimeout(t *testing.T) {
+	cb := &fakeClipboard{text: "local-signal"}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := WaitChange(ctx, cb, "local-signal", 5*time.Millisecond); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want deadline exceeded", err)
+	}
+}
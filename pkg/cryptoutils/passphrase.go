@@ -0,0 +1,73 @@
+/*
+ *   Copyright (c) 2021 Anton Brekhov
+ *   All rights reserved.
+ */
+package cryptoutils
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/abrekhov/hypertunnel/pkg/hashutils"
+)
+
+// Passphrase stream header: magic followed by format version, then random
+// salt the key is derived with. Stream made by Writer follows.
+var passphraseMagic = []byte("HTE")
+
+const passphraseVersion byte = 1
+
+// ErrUnknownFormat is returned by NewPassphraseReader for input without
+// passphrase stream header
+var ErrUnknownFormat = errors.New("input has no encrypted stream header")
+
+// NewPassphraseWriter writes header and fresh salt to w and returns Writer
+// encrypting with key derived from passphrase. The passphrase itself is never
+// written. Close must be called to seal the final segment.
+func NewPassphraseWriter(w io.Writer, passphrase string) (*Writer, error) {
+	salt, err := hashutils.GenerateSalt()
+	if err != nil {
+		return nil, err
+	}
+	key, err := hashutils.DeriveKey(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	header := append(append([]byte{}, passphraseMagic...), passphraseVersion)
+	if _, err := w.Write(append(header, salt...)); err != nil {
+		return nil, err
+	}
+	return NewWriter(w, key)
+}
+
+// NewPassphraseReader reads header and salt from r and returns Reader
+// decrypting stream made by NewPassphraseWriter with the same passphrase.
+// Reader returns data of authenticated segments only, so a wrong passphrase
+// fails with ErrAuthFailed on the first Read.
+func NewPassphraseReader(r io.Reader, passphrase string) (*Reader, error) {
+	br := bufio.NewReader(r)
+	header, err := br.Peek(len(passphraseMagic) + 1)
+	if err != nil || !bytes.Equal(header[:len(passphraseMagic)], passphraseMagic) {
+		return nil, ErrUnknownFormat
+	}
+	if version := header[len(passphraseMagic)]; version != passphraseVersion {
+		return nil, fmt.Errorf("unsupported encrypted stream version %d", version)
+	}
+	br.Discard(len(header))
+
+	salt := make([]byte, hashutils.SaltSize)
+	if _, err := io.ReadFull(br, salt); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, ErrAuthFailed
+		}
+		return nil, err
+	}
+	key, err := hashutils.DeriveKey(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	return NewReader(br, key)
+}
@@ -0,0 +1,81 @@
+/*
+ *   Copyright (c) 2021 Anton Brekhov
+ *   All rights reserved.
+ */
+package cryptoutils
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func encryptPassphrase(t *testing.T, passphrase string, plain []byte) []byte {
+	t.Helper()
+	var out bytes.Buffer
+	w, err := NewPassphraseWriter(&out, passphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(plain); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return out.Bytes()
+}
+
+func TestPassphraseRoundTrip(t *testing.T) {
+	plain := bytes.Repeat([]byte("passphrase "), 10000)
+	encrypted := encryptPassphrase(t, "correct horse", plain)
+	if !bytes.HasPrefix(encrypted, append([]byte("HTE"), passphraseVersion)) {
+		t.Errorf("stream starts with %q, want header", encrypted[:4])
+	}
+
+	// Read through a pipe in small pieces, nothing needs to seek
+	pr, pw := io.Pipe()
+	go func() {
+		for data := encrypted; len(data) > 0; data = data[min(len(data), 100):] {
+			pw.Write(data[:min(len(data), 100)])
+		}
+		pw.Close()
+	}()
+	r, err := NewPassphraseReader(pr, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, plain) {
+		t.Error("decrypted data differs from plaintext")
+	}
+}
+
+func TestPassphraseReaderErrors(t *testing.T) {
+	encrypted := encryptPassphrase(t, "correct horse", []byte("secret"))
+
+	r, err := NewPassphraseReader(bytes.NewReader(encrypted), "battery staple")
+	if err == nil {
+		_, err = io.ReadAll(r)
+	}
+	if !errors.Is(err, ErrAuthFailed) {
+		t.Errorf("wrong passphrase: err = %v, want ErrAuthFailed", err)
+	}
+
+	if _, err := NewPassphraseReader(bytes.NewReader([]byte("plain text")), "correct horse"); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("no header: err = %v, want ErrUnknownFormat", err)
+	}
+
+	unsupported := append([]byte("HTE"), 99)
+	if _, err := NewPassphraseReader(bytes.NewReader(unsupported), "correct horse"); err == nil {
+		t.Error("unsupported version accepted")
+	}
+
+	if _, err := NewPassphraseReader(bytes.NewReader(encrypted[:10]), "correct horse"); !errors.Is(err, ErrAuthFailed) {
+		t.Errorf("truncated salt: err = %v, want ErrAuthFailed", err)
+	}
+}
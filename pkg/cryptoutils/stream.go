@@ -0,0 +1,200 @@
+/*
+ *   Copyright (c) 2021 Anton Brekhov
+ *   All rights reserved.
+ */
+package cryptoutils
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// SegmentSize is the plaintext size of every GCM segment except the last one
+const SegmentSize = 64 * 1024
+
+var (
+	// ErrAuthFailed is returned when a segment can't be authenticated
+	ErrAuthFailed = errors.New("authentication failed: wrong keyphrase or corrupted data")
+	// ErrTooManySegments is returned when the segment counter would overflow
+	ErrTooManySegments = errors.New("stream is too long")
+)
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// segmentNonce derives nonce of segment from base nonce, segment counter and
+// final segment flag, so segments can't be reordered, dropped or truncated.
+func segmentNonce(base []byte, counter uint32, last bool) []byte {
+	nonce := make([]byte, len(base))
+	copy(nonce, base)
+	n := len(nonce)
+	c := binary.BigEndian.Uint32(nonce[n-5 : n-1])
+	binary.BigEndian.PutUint32(nonce[n-5:n-1], c^counter)
+	if last {
+		nonce[n-1] ^= 1
+	}
+	return nonce
+}
+
+// Writer encrypts everything written to it with AES-GCM in segments of
+// SegmentSize. Random base nonce is written first. Close must be called to
+// seal the final segment.
+type Writer struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	nonce   []byte
+	counter uint32
+	buf     []byte
+	out     []byte
+	closed  bool
+}
+
+// NewWriter writes a random nonce to w and returns Writer encrypting with key.
+// Key must be 16, 24 or 32 bytes long.
+func NewWriter(w io.Writer, key []byte) (*Writer, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(nonce); err != nil {
+		return nil, err
+	}
+	return &Writer{
+		w:     w,
+		aead:  aead,
+		nonce: nonce,
+		buf:   make([]byte, 0, SegmentSize),
+		out:   make([]byte, 0, SegmentSize+aead.Overhead()),
+	}, nil
+}
+
+// Write buffers p and seals full segments
+func (sw *Writer) Write(p []byte) (int, error) {
+	if sw.closed {
+		return 0, io.ErrClosedPipe
+	}
+	written := 0
+	for len(p) > 0 {
+		// Seal only when more data follows, the last segment is sealed by Close
+		if len(sw.buf) == SegmentSize {
+			if err := sw.seal(false); err != nil {
+				return written, err
+			}
+		}
+		n := copy(sw.buf[len(sw.buf):SegmentSize], p)
+		sw.buf = sw.buf[:len(sw.buf)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+// Close seals the final segment. It doesn't close the underlying writer.
+func (sw *Writer) Close() error {
+	if sw.closed {
+		return nil
+	}
+	sw.closed = true
+	return sw.seal(true)
+}
+
+func (sw *Writer) seal(last bool) error {
+	if sw.counter == ^uint32(0) {
+		return ErrTooManySegments
+	}
+	sw.out = sw.aead.Seal(sw.out[:0], segmentNonce(sw.nonce, sw.counter, last), sw.buf, nil)
+	sw.counter++
+	sw.buf = sw.buf[:0]
+	_, err := sw.w.Write(sw.out)
+	return err
+}
+
+// Reader decrypts stream produced by Writer. Read returns ErrAuthFailed as
+// soon as a segment fails authentication or the stream is truncated.
+type Reader struct {
+	r       *bufio.Reader
+	aead    cipher.AEAD
+	nonce   []byte
+	counter uint32
+	seg     []byte
+	plain   []byte
+	done    bool
+}
+
+// NewReader reads base nonce from r and returns Reader decrypting with key
+func NewReader(r io.Reader, key []byte) (*Reader, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(r, nonce); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, ErrAuthFailed
+		}
+		return nil, err
+	}
+	return &Reader{
+		r:     bufio.NewReaderSize(r, SegmentSize+aead.Overhead()),
+		aead:  aead,
+		nonce: nonce,
+		seg:   make([]byte, SegmentSize+aead.Overhead()),
+	}, nil
+}
+
+// Read returns decrypted data of authenticated segments
+func (sr *Reader) Read(p []byte) (int, error) {
+	for len(sr.plain) == 0 {
+		if sr.done {
+			return 0, io.EOF
+		}
+		if err := sr.open(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, sr.plain)
+	sr.plain = sr.plain[n:]
+	return n, nil
+}
+
+func (sr *Reader) open() error {
+	n, err := io.ReadFull(sr.r, sr.seg)
+	switch err {
+	case nil:
+	case io.ErrUnexpectedEOF:
+		sr.done = true
+	case io.EOF:
+		// Final segment is missing
+		return ErrAuthFailed
+	default:
+		return err
+	}
+	if !sr.done {
+		if _, err := sr.r.Peek(1); err == io.EOF {
+			sr.done = true
+		} else if err != nil {
+			return err
+		}
+	}
+	plain, err := sr.aead.Open(sr.seg[:0], segmentNonce(sr.nonce, sr.counter, sr.done), sr.seg[:n], nil)
+	if err != nil {
+		return ErrAuthFailed
+	}
+	sr.counter++
+	sr.plain = plain
+	return nil
+}
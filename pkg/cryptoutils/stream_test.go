@@ -0,0 +1,90 @@
+/*
+ *   Copyright (c) 2021 Anton Brekhov
+ *   All rights reserved.
+ */
+package cryptoutils
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"testing"
+)
+
+var testKey = bytes.Repeat([]byte{0x42}, 32)
+
+func encryptBytes(t *testing.T, key, plain []byte) []byte {
+	t.Helper()
+	var out bytes.Buffer
+	w, err := NewWriter(&out, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(plain); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return out.Bytes()
+}
+
+func decryptBytes(key, ciphertext []byte) ([]byte, error) {
+	r, err := NewReader(bytes.NewReader(ciphertext), key)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+func TestStreamRoundTrip(t *testing.T) {
+	for _, size := range []int{0, 1, SegmentSize - 1, SegmentSize, SegmentSize + 1, 3*SegmentSize + 17} {
+		plain := make([]byte, size)
+		rand.Read(plain)
+		got, err := decryptBytes(testKey, encryptBytes(t, testKey, plain))
+		if err != nil {
+			t.Fatalf("size %d: %v", size, err)
+		}
+		if !bytes.Equal(got, plain) {
+			t.Errorf("size %d: round trip mismatch", size)
+		}
+	}
+}
+
+func TestStreamTamperDetection(t *testing.T) {
+	plain := bytes.Repeat([]byte("secret"), SegmentSize/2)
+	ciphertext := encryptBytes(t, testKey, plain)
+
+	for _, pos := range []int{0, 20, SegmentSize + 30, len(ciphertext) - 1} {
+		tampered := append([]byte(nil), ciphertext...)
+		tampered[pos] ^= 0x01
+		if _, err := decryptBytes(testKey, tampered); !errors.Is(err, ErrAuthFailed) {
+			t.Errorf("flipped byte %d: err = %v, want ErrAuthFailed", pos, err)
+		}
+	}
+}
+
+func TestStreamTruncation(t *testing.T) {
+	plain := bytes.Repeat([]byte("x"), 2*SegmentSize+10)
+	ciphertext := encryptBytes(t, testKey, plain)
+
+	// Drop the final segment, the remaining stream ends on a segment boundary
+	nonceSize := 12
+	segment := SegmentSize + 16
+	truncated := ciphertext[:nonceSize+2*segment]
+	if _, err := decryptBytes(testKey, truncated); !errors.Is(err, ErrAuthFailed) {
+		t.Errorf("truncated stream: err = %v, want ErrAuthFailed", err)
+	}
+	if _, err := decryptBytes(testKey, ciphertext[:nonceSize]); !errors.Is(err, ErrAuthFailed) {
+		t.Errorf("nonce only: err = %v, want ErrAuthFailed", err)
+	}
+}
+
+func TestStreamWrongKey(t *testing.T) {
+	ciphertext := encryptBytes(t, testKey, []byte("hello"))
+	wrongKey := bytes.Repeat([]byte{0x24}, 32)
+	if _, err := decryptBytes(wrongKey, ciphertext); !errors.Is(err, ErrAuthFailed) {
+		t.Errorf("err = %v, want ErrAuthFailed", err)
+	}
+}
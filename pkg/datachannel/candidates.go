@@ -0,0 +1,92 @@
+/*
+ *   Copyright (c) 2021 Anton Brekhov
+ *   All rights reserved.
+ */
+package datachannel
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pion/webrtc/v3"
+	log "github.com/sirupsen/logrus"
+)
+
+// defaultLocalPreference is used when a candidate priority has to be recomputed
+const defaultLocalPreference = 65535
+
+// typePreference returns RFC 8445 recommended type preference for candidate type
+func typePreference(t webrtc.ICECandidateType) uint32 {
+	switch t {
+	case webrtc.ICECandidateTypeHost:
+		return 126
+	case webrtc.ICECandidateTypePrflx:
+		return 110
+	case webrtc.ICECandidateTypeSrflx:
+		return 100
+	default:
+		return 0
+	}
+}
+
+// candidatePriority computes RFC 8445 priority for candidate type and component
+func candidatePriority(t webrtc.ICECandidateType, localPref uint32, component uint16) uint32 {
+	return (1<<24)*typePreference(t) + (1<<8)*localPref + (256 - uint32(component))
+}
+
+// NormalizeCandidates drops duplicate candidates (same address, port, protocol
+// and type) and recomputes priorities that don't match the candidate type.
+// Order of the remaining candidates is preserved.
+func NormalizeCandidates(candidates []webrtc.ICECandidate) []webrtc.ICECandidate {
+	seen := make(map[string]struct{}, len(candidates))
+	normalized := make([]webrtc.ICECandidate, 0, len(candidates))
+	for _, c := range candidates {
+		key := fmt.Sprintf("%s|%d|%s|%s", c.Address, c.Port, c.Protocol, c.Typ)
+		if _, ok := seen[key]; ok {
+			log.Debugf("Dropping duplicate candidate %s\n", key)
+			continue
+		}
+		seen[key] = struct{}{}
+
+		if c.Component == 0 {
+			c.Component = 1
+		}
+		if c.Priority == 0 || c.Priority>>24 != typePreference(c.Typ) {
+			p := candidatePriority(c.Typ, defaultLocalPreference, c.Component)
+			log.Debugf("Candidate %s priority %d recomputed to %d\n", key, c.Priority, p)
+			c.Priority = p
+		}
+		normalized = append(normalized, c)
+	}
+	return normalized
+}
+
+// IsMDNSCandidate reports whether candidate address is an mDNS .local hostname
+// rather than IP address. Such candidates can only be resolved on the same LAN.
+func IsMDNSCandidate(c webrtc.ICECandidate) bool {
+	return strings.HasSuffix(strings.TrimSuffix(c.Address, "."), ".local")
+}
+
+// DropMDNSCandidates removes mDNS candidates, for peers that don't resolve them
+func DropMDNSCandidates(candidates []webrtc.ICECandidate) []webrtc.ICECandidate {
+	kept := make([]webrtc.ICECandidate, 0, len(candidates))
+	for _, c := range candidates {
+		if IsMDNSCandidate(c) {
+			log.Debugf("Dropping mDNS candidate %s:%d\n", c.Address, c.Port)
+			continue
+		}
+		kept = append(kept, c)
+	}
+	return kept
+}
+
+// FilterCandidates returns candidates keep returns true for
+func FilterCandidates(candidates []webrtc.ICECandidate, keep func(webrtc.ICECandidate) bool) []webrtc.ICECandidate {
+	kept := make([]webrtc.ICECandidate, 0, len(candidates))
+	for _, c := range candidates {
+		if keep(c) {
+			kept = append(kept, c)
+		}
+	}
+	return kept
+}
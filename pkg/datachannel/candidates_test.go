@@ -0,0 +1,147 @@
+/*
+ *   Copyright (c) 2021 Anton Brekhov
+ *   All rights reserved.
+ */
+package datachannel
+
+import (
+	"testing"
+
+	"github.com/pion/webrtc/v3"
+)
+
+func TestNormalizeCandidatesDropsDuplicates(t *testing.T) {
+	host := webrtc.ICECandidate{
+		Foundation: "1",
+		Priority:   candidatePriority(webrtc.ICECandidateTypeHost, 65535, 1),
+		Address:    "192.168.1.10",
+		Protocol:   webrtc.ICEProtocolUDP,
+		Port:       50000,
+		Typ:        webrtc.ICECandidateTypeHost,
+		Component:  1,
+	}
+	srflx := host
+	srflx.Foundation = "2"
+	srflx.Address = "203.0.113.7"
+	srflx.Typ = webrtc.ICECandidateTypeSrflx
+	srflx.Priority = candidatePriority(webrtc.ICECandidateTypeSrflx, 65535, 1)
+	dup := host
+	dup.Foundation = "3"
+
+	got := NormalizeCandidates([]webrtc.ICECandidate{host, srflx, dup})
+	if len(got) != 2 {
+		t.Fatalf("got %d candidates, want 2", len(got))
+	}
+	if got[0].Foundation != "1" || got[1].Foundation != "2" {
+		t.Errorf("unexpected order: %q, %q", got[0].Foundation, got[1].Foundation)
+	}
+}
+
+func TestNormalizeCandidatesPriority(t *testing.T) {
+	valid := candidatePriority(webrtc.ICECandidateTypeHost, 1000, 1)
+	tests := []struct {
+		name     string
+		in       webrtc.ICECandidate
+		wantPrio uint32
+		wantComp uint16
+	}{
+		{
+			name:     "valid priority kept",
+			in:       webrtc.ICECandidate{Address: "10.0.0.1", Port: 1, Typ: webrtc.ICECandidateTypeHost, Priority: valid, Component: 1},
+			wantPrio: valid,
+			wantComp: 1,
+		},
+		{
+			name:     "zero priority recomputed",
+			in:       webrtc.ICECandidate{Address: "10.0.0.1", Port: 1, Typ: webrtc.ICECandidateTypeHost, Component: 1},
+			wantPrio: candidatePriority(webrtc.ICECandidateTypeHost, defaultLocalPreference, 1),
+			wantComp: 1,
+		},
+		{
+			name:     "priority of wrong type recomputed",
+			in:       webrtc.ICECandidate{Address: "10.0.0.1", Port: 1, Typ: webrtc.ICECandidateTypeRelay, Priority: valid, Component: 1},
+			wantPrio: candidatePriority(webrtc.ICECandidateTypeRelay, defaultLocalPreference, 1),
+			wantComp: 1,
+		},
+		{
+			name:     "missing component defaults to 1",
+			in:       webrtc.ICECandidate{Address: "10.0.0.1", Port: 1, Typ: webrtc.ICECandidateTypeHost, Priority: valid},
+			wantPrio: valid,
+			wantComp: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NormalizeCandidates([]webrtc.ICECandidate{tt.in})
+			if got[0].Priority != tt.wantPrio {
+				t.Errorf("priority = %d, want %d", got[0].Priority, tt.wantPrio)
+			}
+			if got[0].Component != tt.wantComp {
+				t.Errorf("component = %d, want %d", got[0].Component, tt.wantComp)
+			}
+		})
+	}
+}
+
+func TestNormalizeCandidatesTypeOrdering(t *testing.T) {
+	host := candidatePriority(webrtc.ICECandidateTypeHost, defaultLocalPreference, 1)
+	srflx := candidatePriority(webrtc.ICECandidateTypeSrflx, defaultLocalPreference, 1)
+	relay := candidatePriority(webrtc.ICECandidateTypeRelay, defaultLocalPreference, 1)
+	if !(host > srflx && srflx > relay) {
+		t.Errorf("priorities not ordered host > srflx > relay: %d, %d, %d", host, srflx, relay)
+	}
+}
+
+func TestMDNSCandidateRoundTrip(t *testing.T) {
+	mdns := webrtc.ICECandidate{
+		Foundation: "1",
+		Priority:   candidatePriority(webrtc.ICECandidateTypeHost, 65535, 1),
+		Address:    "4f1c2a9e-6b0d-4c1e-9a53-2d7f0e8b1c44.local",
+		Protocol:   webrtc.ICEProtocolUDP,
+		Port:       50000,
+		Typ:        webrtc.ICECandidateTypeHost,
+		Component:  1,
+	}
+	encoded, err := EncodeSignal(Signal{ICECandidates: []webrtc.ICECandidate{mdns}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Signal
+	if err := DecodeSignal(encoded, &got); err != nil {
+		t.Fatal(err)
+	}
+	candidates := NormalizeCandidates(got.ICECandidates)
+	if len(candidates) != 1 || candidates[0] != mdns {
+		t.Fatalf("candidates = %+v, want %+v", candidates, mdns)
+	}
+	if !IsMDNSCandidate(candidates[0]) {
+		t.Error("round-tripped candidate not recognized as mDNS")
+	}
+}
+
+func TestDropMDNSCandidates(t *testing.T) {
+	candidates := []webrtc.ICECandidate{
+		{Foundation: "1", Address: "host.local", Typ: webrtc.ICECandidateTypeHost},
+		{Foundation: "2", Address: "192.168.1.10", Typ: webrtc.ICECandidateTypeHost},
+		{Foundation: "3", Address: "other.local.", Typ: webrtc.ICECandidateTypeHost},
+		{Foundation: "4", Address: "203.0.113.7", Typ: webrtc.ICECandidateTypeSrflx},
+	}
+	got := DropMDNSCandidates(candidates)
+	if len(got) != 2 || got[0].Foundation != "2" || got[1].Foundation != "4" {
+		t.Errorf("got %+v, want IP candidates 2 and 4", got)
+	}
+}
+
+func TestFilterCandidates(t *testing.T) {
+	candidates := []webrtc.ICECandidate{
+		{Foundation: "1", Address: "192.168.1.10", Typ: webrtc.ICECandidateTypeHost},
+		{Foundation: "2", Address: "203.0.113.7", Typ: webrtc.ICECandidateTypeSrflx},
+		{Foundation: "3", Address: "198.51.100.2", Typ: webrtc.ICECandidateTypeRelay},
+	}
+	got := FilterCandidates(candidates, func(c webrtc.ICECandidate) bool {
+		return c.Typ != webrtc.ICECandidateTypeHost
+	})
+	if len(got) != 2 || got[0].Foundation != "2" || got[1].Foundation != "3" {
+		t.Errorf("got %+v, want candidates 2 and 3", got)
+	}
+}
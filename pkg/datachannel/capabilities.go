@@ -0,0 +1,76 @@
+/*
+ *   Copyright (c) 2021 Anton Brekhov
+ *   All rights reserved.
+ */
+package datachannel
+
+import "fmt"
+
+// Checksum algorithms and compression codecs peers may advertise
+const (
+	ChecksumSHA256  = "sha256"
+	CompressionNone = "none"
+)
+
+// Capabilities advertises checksum algorithms and compression codecs a peer
+// supports
+type Capabilities struct {
+	ChecksumAlgorithms []string `json:"checksums,omitempty"`
+	Compression        []string `json:"compression,omitempty"`
+	// Framing is support of typed frames, see FrameMessage
+	Framing bool `json:"framing,omitempty"`
+}
+
+// Agreement is what both peers support. Checksum algorithms and codecs are
+// only checked for overlap: sha256 and no compression are all this build
+// has, so there is nothing to pick yet.
+type Agreement struct {
+	Framing bool
+}
+
+// defaultCapabilities is assumed for peers which don't advertise anything
+var defaultCapabilities = Capabilities{
+	ChecksumAlgorithms: []string{ChecksumSHA256},
+	Compression:        []string{CompressionNone},
+}
+
+// LocalCapabilities returns what this build supports
+func LocalCapabilities() *Capabilities {
+	return &Capabilities{
+		ChecksumAlgorithms: []string{ChecksumSHA256},
+		Compression:        []string{CompressionNone},
+		Framing:            true,
+	}
+}
+
+// Negotiate checks that peers share a checksum algorithm and a compression
+// codec and returns what both support. Both peers call it with their own
+// capabilities as local and get the same result, Negotiate(a, b) equals
+// Negotiate(b, a). Nil capabilities stand for peers predating the negotiation.
+func Negotiate(local, remote *Capabilities) (Agreement, error) {
+	if local == nil {
+		local = &defaultCapabilities
+	}
+	if remote == nil {
+		remote = &defaultCapabilities
+	}
+	if !overlap(local.ChecksumAlgorithms, remote.ChecksumAlgorithms) {
+		return Agreement{}, fmt.Errorf("no common checksum algorithm: local %v, remote %v", local.ChecksumAlgorithms, remote.ChecksumAlgorithms)
+	}
+	if !overlap(local.Compression, remote.Compression) {
+		return Agreement{}, fmt.Errorf("no common compression codec: local %v, remote %v", local.Compression, remote.Compression)
+	}
+	return Agreement{Framing: local.Framing && remote.Framing}, nil
+}
+
+// overlap reports whether a and b have an element in common
+func overlap(a, b []string) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+/*
+ *   Copyright (c) 2021 Anton Brekhov
+ *   All rights reserved.
+ */
+package datachannel
+
+import "testing"
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		name    string
+		local   *Capabilities
+		remote  *Capabilities
+		want    Agreement
+		wantErr bool
+	}{
+		{
+			name:   "different preference order",
+			local:  &Capabilities{ChecksumAlgorithms: []string{"blake3", "sha256"}, Compression: []string{"zstd", "gzip", "none"}},
+			remote: &Capabilities{ChecksumAlgorithms: []string{"sha256", "blake3"}, Compression: []string{"none", "gzip", "zstd"}},
+			want:   Agreement{},
+		},
+		{
+			name:   "old peer without capabilities",
+			local:  &Capabilities{ChecksumAlgorithms: []string{"blake3", "sha256"}, Compression: []string{"zstd", "none"}},
+			remote: nil,
+			want:   Agreement{},
+		},
+		{
+			name:   "local build",
+			local:  LocalCapabilities(),
+			remote: LocalCapabilities(),
+			want:   Agreement{Framing: true},
+		},
+		{
+			name:   "old peer without framing",
+			local:  LocalCapabilities(),
+			remote: &Capabilities{ChecksumAlgorithms: []string{"sha256"}, Compression: []string{"none"}},
+			want:   Agreement{},
+		},
+		{
+			name:    "no common checksum",
+			local:   &Capabilities{ChecksumAlgorithms: []string{"blake3"}, Compression: []string{"none"}},
+			remote:  &Capabilities{ChecksumAlgorithms: []string{"sha256"}, Compression: []string{"none"}},
+			wantErr: true,
+		},
+		{
+			name:    "no common codec",
+			local:   &Capabilities{ChecksumAlgorithms: []string{"sha256"}, Compression: []string{"zstd"}},
+			remote:  &Capabilities{ChecksumAlgorithms: []string{"sha256"}, Compression: []string{"gzip"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Negotiate(tt.local, tt.remote)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Negotiate = %+v, want %+v", got, tt.want)
+			}
+			// Each peer negotiates with itself as local
+			swapped, err := Negotiate(tt.remote, tt.local)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("swapped: err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if swapped != got {
+				t.Errorf("Negotiate(remote, local) = %+v, Negotiate(local, remote) = %+v", swapped, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+/*
+ *   Copyright (c) 2021 Anton Brekhov
+ *   All rights reserved.
+ */
+package datachannel
+
+import (
+	"io"
+	"time"
+
+	"github.com/abrekhov/hypertunnel/pkg/transfer"
+)
+
+// Config controls how files are received
+type Config struct {
+	// AutoAccept receives files without asking, taken names are renamed
+	AutoAccept bool
+	// Force overwrites existing files without asking
+	Force bool
+	// Fsync flushes received file to stable storage before reporting success
+	Fsync bool
+	// CollisionFormat renames received file when the name is taken
+	CollisionFormat transfer.CollisionStrategy
+	// FlushInterval is how often buffered received data is written to the file
+	FlushInterval time.Duration
+	// IdleTimeout aborts transfer when no data flows this long after the
+	// channel opened, 0 waits forever
+	IdleTimeout time.Duration
+	// MaxConnections limits incoming data channels handled at once, 0 is unlimited
+	MaxConnections int
+	// Dir is where received files are saved, the working directory when empty
+	Dir string
+	// Framed expects typed frames, set when both peers agreed on framing
+	Framed bool
+	// Sink receives files instead of the working directory when set, names
+	// are not checked for collisions then
+	Sink Sink
+	// Filter wraps the destination of received data when set, e.g. to
+	// decrypt it. Closing the wrapper must close the destination.
+	Filter func(io.WriteCloser) io.WriteCloser
+	// Summary gets a JSON line for every accepted transfer once it ends, nil
+	// disables it
+	Summary io.Writer
+}
+
+// DefaultConfig returns configuration used when nothing is set
+func DefaultConfig() Config {
+	return Config{
+		CollisionFormat: transfer.CollisionNumber,
+		FlushInterval:   time.Second,
+	}
+}
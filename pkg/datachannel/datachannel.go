@@ -14,36 +14,69 @@ import (
 	"github.com/spf13/cobra"
 )
 
-// Encode base64 SDP
+// EncodeSignal returns base64 encoded JSON of signal
+func EncodeSignal(s Signal) (string, error) {
+	return encode(s)
+}
+
+// DecodeSignal fills s from base64 encoded JSON
+func DecodeSignal(in string, s *Signal) error {
+	return decode(in, s)
+}
+
+// Encode base64 SDP, exits on error
 func Encode(obj interface{}) string {
-	b, err := json.Marshal(obj)
-	logrus.Debugf("%#v\n", string(b))
+	out, err := encode(obj)
 	cobra.CheckErr(err)
-	return base64.StdEncoding.EncodeToString(b)
+	return out
 }
 
-// Decode base64 SDP
+// Decode base64 SDP, exits on error
 func Decode(in string, obj interface{}) {
-	b, err := base64.StdEncoding.DecodeString(in)
-	cobra.CheckErr(err)
+	cobra.CheckErr(decode(in, obj))
+}
 
+func encode(obj interface{}) (string, error) {
+	b, err := json.Marshal(obj)
+	if err != nil {
+		return "", fmt.Errorf("encode signal: %w", err)
+	}
 	logrus.Debugf("%#v\n", string(b))
-	err = json.Unmarshal(b, obj)
-	cobra.CheckErr(err)
+	return base64.StdEncoding.EncodeToString(b), nil
 }
 
-// MustReadStdin waiting for base64 encoded SDP for connection
-func MustReadStdin() string {
+func decode(in string, obj interface{}) error {
+	b, err := base64.StdEncoding.DecodeString(in)
+	if err != nil {
+		return fmt.Errorf("decode signal: %w", err)
+	}
+	logrus.Debugf("%#v\n", string(b))
+	if err := json.Unmarshal(b, obj); err != nil {
+		return fmt.Errorf("decode signal: %w", err)
+	}
+	return nil
+}
+
+// ReadSignalFromStdin waits for base64 encoded SDP for connection
+func ReadSignalFromStdin() (string, error) {
 	var sdpOffer string
 	prompt := &survey.Multiline{
 		Message: "Paste your SDP offer (end with Ctrl+D):",
 	}
-	err := survey.AskOne(prompt, &sdpOffer)
+	if err := survey.AskOne(prompt, &sdpOffer); err != nil {
+		return "", err
+	}
+	fmt.Println("Received SDP Offer:")
+	fmt.Println(sdpOffer)
+	return sdpOffer, nil
+}
+
+// MustReadStdin waiting for base64 encoded SDP for connection
+func MustReadStdin() string {
+	sdpOffer, err := ReadSignalFromStdin()
 	if err != nil {
 		fmt.Println("Error:", err)
 		return ""
 	}
-	fmt.Println("Received SDP Offer:")
-	fmt.Println(sdpOffer)
 	return sdpOffer
 }
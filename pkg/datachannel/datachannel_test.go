@@ -5,13 +5,67 @@
 package datachannel
 
 import (
-	"errors"
+	"encoding/base64"
 	"testing"
+
+	"github.com/pion/webrtc/v3"
 )
 
-func TestEncode(t *testing.T) {
+func TestEncodeSignalRoundTrip(t *testing.T) {
+	s := Signal{
+		ICEParameters:    webrtc.ICEParameters{UsernameFragment: "ufrag", Password: "pwd"},
+		SCTPCapabilities: webrtc.SCTPCapabilities{MaxMessageSize: 16384},
+		Capabilities:     LocalCapabilities(),
+	}
+	encoded, err := EncodeSignal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Signal
+	if err := DecodeSignal(encoded, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.ICEParameters != s.ICEParameters {
+		t.Errorf("ICE parameters = %+v, want %+v", got.ICEParameters, s.ICEParameters)
+	}
+	if got.SCTPCapabilities.MaxMessageSize != 16384 {
+		t.Errorf("max message size = %d, want 16384", got.SCTPCapabilities.MaxMessageSize)
+	}
+	if got.Capabilities == nil || len(got.Capabilities.ChecksumAlgorithms) == 0 {
+		t.Errorf("capabilities lost: %+v", got.Capabilities)
+	}
+}
+
+func TestEncodeSignalICELite(t *testing.T) {
+	s := Signal{
+		ICEParameters: webrtc.ICEParameters{UsernameFragment: "ufrag", Password: "pwd", ICELite: true},
+	}
+	encoded, err := EncodeSignal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Signal
+	if err := DecodeSignal(encoded, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !got.ICEParameters.ICELite {
+		t.Error("ICELite lost in round trip")
+	}
+}
 
-	t.Error(errors.New("asdfasdf"))
+func TestDecodeSignalMalformed(t *testing.T) {
+	tests := map[string]string{
+		"bad base64": "not base64!",
+		"bad json":   base64.StdEncoding.EncodeToString([]byte("{not json")),
+	}
+	for name, in := range tests {
+		t.Run(name, func(t *testing.T) {
+			var s Signal
+			if err := DecodeSignal(in, &s); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
 }
 
 func TestMustReadStdin(t *testing.T) {
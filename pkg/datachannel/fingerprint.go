@@ -0,0 +1,72 @@
+/*
+ *   Copyright (c) 2021 Anton Brekhov
+ *   All rights reserved.
+ */
+package datachannel
+
+import (
+	"crypto/sha256"
+	"strings"
+)
+
+// fingerprintWords is how many words SignalFingerprint renders, 8 bits each.
+// 64 bits keep a man in the middle from generating certificates until one
+// matches.
+const fingerprintWords = 8
+
+// fingerprintWordList has 256 short words easy to tell apart over voice
+var fingerprintWordList = [256]string{
+	"acid", "acorn", "actor", "adobe", "agent", "alarm", "album", "alien",
+	"alpha", "amber", "angel", "ankle", "apple", "apron", "arena", "argon",
+	"arrow", "aspen", "atlas", "attic", "audio", "bacon", "badge", "bagel",
+	"baker", "banjo", "basil", "beach", "bench", "berry", "bison", "blade",
+	"bonus", "boxer", "bread", "brick", "bugle", "cabin", "camel", "candy",
+	"canoe", "cargo", "cedar", "cello", "chalk", "chess", "cider", "cocoa",
+	"comet", "coral", "cuckoo", "daisy", "dancer", "delta", "denim", "desert",
+	"diary", "dinner", "domino", "donkey", "dragon", "drum", "dune", "dynamo",
+	"eagle", "easel", "echo", "elbow", "elm", "ember", "engine", "equal",
+	"fable", "falcon", "fennel", "ferry", "fiber", "fiddle", "figure", "flame",
+	"flute", "forest", "forge", "fossil", "fox", "frost", "fudge", "galaxy",
+	"garden", "garlic", "gecko", "geyser", "giant", "ginger", "glove", "goblet",
+	"gopher", "gravy", "guitar", "gull", "habit", "hammer", "harbor", "hazel",
+	"helmet", "hermit", "honey", "hornet", "husky", "igloo", "index", "ink",
+	"iris", "island", "ivory", "jacket", "jaguar", "jelly", "jewel", "jigsaw",
+	"jockey", "judge", "juice", "jungle", "kayak", "kernel", "kettle", "kiwi",
+	"koala", "ladder", "lagoon", "laser", "lava", "lemon", "lentil", "lilac",
+	"lily", "lizard", "locket", "lunar", "magnet", "mango", "maple", "marble",
+	"meadow", "medal", "melon", "meteor", "mint", "mirror", "mitten", "monkey",
+	"mosaic", "muffin", "napkin", "nectar", "needle", "nickel", "noble", "noodle",
+	"nugget", "nutmeg", "oasis", "ocean", "olive", "onion", "opal", "orbit",
+	"orchid", "otter", "oyster", "paddle", "panda", "paper", "parrot", "peanut",
+	"pearl", "pebble", "pepper", "piano", "pickle", "pilot", "planet", "plum",
+	"pony", "potato", "puffin", "puzzle", "quail", "quartz", "quiet", "quill",
+	"rabbit", "radar", "radish", "raisin", "raven", "ribbon", "river", "robot",
+	"rocket", "ruby", "rudder", "saddle", "salad", "salmon", "sandal", "satin",
+	"scarf", "shadow", "shovel", "silver", "sketch", "sloth", "solar", "spider",
+	"sponge", "statue", "sugar", "summit", "sunset", "tablet", "taco", "tango",
+	"teapot", "temple", "ticket", "tiger", "timber", "toast", "tomato", "topaz",
+	"tulip", "tundra", "turnip", "turtle", "umbra", "valley", "vapor", "velvet",
+	"violin", "voyage", "waffle", "wagon", "walnut", "walrus", "whale", "willow",
+	"window", "wizard", "yacht", "yogurt", "zebra", "zephyr", "zinc", "zipper",
+}
+
+// SignalFingerprint returns a few words derived from DTLS fingerprints of s.
+// Peers read them to each other to make sure they pasted the right signal,
+// like SSH key fingerprints. ICE username fragment is left out: it's chosen
+// freely by whoever made the signal and authenticates nothing.
+func SignalFingerprint(s Signal) string {
+	h := sha256.New()
+	for _, fp := range s.DTLSParameters.Fingerprints {
+		h.Write([]byte(fp.Algorithm))
+		h.Write([]byte{0})
+		h.Write([]byte(fp.Value))
+		h.Write([]byte{0})
+	}
+	sum := h.Sum(nil)
+
+	words := make([]string, fingerprintWords)
+	for i := range words {
+		words[i] = fingerprintWordList[sum[i]]
+	}
+	return strings.Join(words, "-")
+}
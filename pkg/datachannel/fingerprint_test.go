@@ -0,0 +1,60 @@
+/*
+ *   Copyright (c) 2021 Anton Brekhov
+ *   All rights reserved.
+ */
+package datachannel
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/pion/webrtc/v3"
+)
+
+func TestSignalFingerprint(t *testing.T) {
+	signal := func(ufrag, fingerprint string) Signal {
+		return Signal{
+			ICEParameters:  webrtc.ICEParameters{UsernameFragment: ufrag, Password: "password"},
+			DTLSParameters: webrtc.DTLSParameters{Fingerprints: []webrtc.DTLSFingerprint{{Algorithm: "sha-256", Value: fingerprint}}},
+		}
+	}
+	a := SignalFingerprint(signal("ufrag", "AA:BB"))
+	if again := SignalFingerprint(signal("ufrag", "AA:BB")); again != a {
+		t.Errorf("fingerprint changed: %q then %q", a, again)
+	}
+	// Username fragment is chosen by whoever made the signal, grinding it
+	// must not change the words
+	if other := SignalFingerprint(signal("other", "AA:BB")); other != a {
+		t.Errorf("fingerprint depends on ufrag: %q and %q", a, other)
+	}
+	if got := SignalFingerprint(signal("ufrag", "CC:DD")); got == a {
+		t.Errorf("different certificates share fingerprint %q", a)
+	}
+}
+
+func TestSignalFingerprintEntropy(t *testing.T) {
+	known := make(map[string]bool, len(fingerprintWordList))
+	for _, w := range fingerprintWordList {
+		if known[w] {
+			t.Errorf("word %q listed twice", w)
+		}
+		known[w] = true
+	}
+	if bits := fingerprintWords * math.Log2(float64(len(known))); bits < 64 {
+		t.Errorf("fingerprint carries %.0f bits, want at least 64", bits)
+	}
+
+	fp := SignalFingerprint(Signal{DTLSParameters: webrtc.DTLSParameters{
+		Fingerprints: []webrtc.DTLSFingerprint{{Algorithm: "sha-256", Value: "AA:BB"}},
+	}})
+	words := strings.Split(fp, "-")
+	if len(words) != fingerprintWords {
+		t.Errorf("fingerprint %q has %d words, want %d", fp, len(words), fingerprintWords)
+	}
+	for _, w := range words {
+		if !known[w] {
+			t.Errorf("fingerprint %q has word %q not in the list", fp, w)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+/*
+ *   Copyright (c) 2021 Anton Brekhov
+ *   All rights reserved.
+ */
+package datachannel
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// FrameType tells what a framed message carries
+type FrameType byte
+
+// Frame types, zero is invalid so empty messages don't parse
+const (
+	FrameMetadata FrameType = iota + 1
+	FrameData
+	FrameControl
+)
+
+// frameHeaderSize is type tag and big endian payload length
+const frameHeaderSize = 1 + 4
+
+// ErrInvalidFrame is returned for messages that aren't well formed frames
+var ErrInvalidFrame = errors.New("invalid frame")
+
+// FrameMessage returns payload prefixed with type tag and its length, so
+// receiver classifies messages by the tag instead of guessing from content
+func FrameMessage(t FrameType, payload []byte) []byte {
+	frame := make([]byte, frameHeaderSize+len(payload))
+	frame[0] = byte(t)
+	binary.BigEndian.PutUint32(frame[1:frameHeaderSize], uint32(len(payload)))
+	copy(frame[frameHeaderSize:], payload)
+	return frame
+}
+
+// ParseMessage splits frame made by FrameMessage into type and payload. The
+// payload shares memory with frame.
+func ParseMessage(frame []byte) (FrameType, []byte, error) {
+	if len(frame) < frameHeaderSize {
+		return 0, nil, fmt.Errorf("%w: %d bytes is shorter than header", ErrInvalidFrame, len(frame))
+	}
+	t := FrameType(frame[0])
+	if t < FrameMetadata || t > FrameControl {
+		return 0, nil, fmt.Errorf("%w: unknown type %d", ErrInvalidFrame, t)
+	}
+	size := binary.BigEndian.Uint32(frame[1:frameHeaderSize])
+	payload := frame[frameHeaderSize:]
+	if uint64(size) != uint64(len(payload)) {
+		return 0, nil, fmt.Errorf("%w: header says %d bytes, got %d", ErrInvalidFrame, size, len(payload))
+	}
+	return t, payload, nil
+}
+
+// framedChannel sends data as FrameData and texts as FrameMetadata frames
+type framedChannel struct {
+	TextSender
+}
+
+func (c framedChannel) Send(data []byte) error {
+	return c.TextSender.Send(FrameMessage(FrameData, data))
+}
+
+func (c framedChannel) SendText(s string) error {
+	return c.TextSender.Send(FrameMessage(FrameMetadata, []byte(s)))
+}
@@ -0,0 +1,48 @@
+/*
+ *   Copyright (c) 2021 Anton Brekhov
+ *   All rights reserved.
+ */
+package datachannel
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestFrameMessageRoundTrip(t *testing.T) {
+	for _, tt := range []struct {
+		typ     FrameType
+		payload []byte
+	}{
+		{FrameData, []byte("chunk of file")},
+		{FrameMetadata, []byte(`HT_FOOT:{"size":1}`)},
+		{FrameControl, nil},
+	} {
+		typ, payload, err := ParseMessage(FrameMessage(tt.typ, tt.payload))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if typ != tt.typ || !bytes.Equal(payload, tt.payload) {
+			t.Errorf("got %d %q, want %d %q", typ, payload, tt.typ, tt.payload)
+		}
+	}
+}
+
+func TestParseMessageInvalid(t *testing.T) {
+	valid := FrameMessage(FrameData, []byte("payload"))
+	tests := map[string][]byte{
+		"empty":        nil,
+		"short header": valid[:3],
+		"unknown type": append([]byte{9}, valid[1:]...),
+		"zero type":    append([]byte{0}, valid[1:]...),
+		"truncated":    valid[:len(valid)-1],
+		"trailing":     append(append([]byte{}, valid...), 'x'),
+		"old footer":   []byte(`HT_FOOT:{"size":1}`),
+	}
+	for name, frame := range tests {
+		if _, _, err := ParseMessage(frame); !errors.Is(err, ErrInvalidFrame) {
+			t.Errorf("%s: err = %v, want ErrInvalidFrame", name, err)
+		}
+	}
+}
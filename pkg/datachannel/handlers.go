@@ -2,62 +2,252 @@ package datachannel
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/abrekhov/hypertunnel/pkg/transfer"
 	"github.com/pion/webrtc/v3"
 	log "github.com/sirupsen/logrus"
-	"github.com/spf13/cobra"
 )
 
-func FileTransferHandler(channel *webrtc.DataChannel) {
+// receiveBufferSize is how much received data is buffered between flushes
+const receiveBufferSize = 1 << 20
+
+// stdinReader reads answers to prompts, replaced in tests
+var stdinReader = bufio.NewReader(os.Stdin)
+
+// fileSyncer and dirSyncer flush to stable storage, replaced in tests
+var (
+	fileSyncer = func(fd *os.File) error { return fd.Sync() }
+	dirSyncer  = syncDir
+)
+
+var (
+	// ErrConnectionLimit is sent on done channel when Config.MaxConnections channels are handled already
+	ErrConnectionLimit = errors.New("connection limit reached")
+	// ErrDeclined is sent on done channel when user refused the file
+	ErrDeclined = errors.New("file declined")
+	// ErrIdleTimeout is sent on done channel when no data came within Config.IdleTimeout
+	ErrIdleTimeout = errors.New("no data from sender within idle timeout")
+)
+
+// ReceiveChannel is the part of webrtc.DataChannel used to receive files
+type ReceiveChannel interface {
+	Label() string
+	ID() *uint16
+	OnOpen(f func())
+	OnClose(f func())
+	OnMessage(f func(msg webrtc.DataChannelMessage))
+	SendText(s string) error
+	Close() error
+}
+
+// FileTransferHandler saves file sent over channel to cfg.Sink, or to the
+// working directory when it's nil. Returned channel gets
+// nil once the file is saved and verified, or the reason transfer failed.
+// The caller decides whether to exit.
+func FileTransferHandler(channel ReceiveChannel, cfg Config) <-chan error {
+	done := make(chan error, 1)
+	var once sync.Once
+	finish := func(err error) {
+		once.Do(func() { done <- err })
+	}
+
 	fmt.Printf("New DataChannel %s %d\n", channel.Label(), channel.ID())
+	if !receivers.acquire(cfg.MaxConnections) {
+		log.Warnf("Declining DataChannel %s: limit of %d connections reached\n", channel.Label(), cfg.MaxConnections)
+		channel.Close()
+		finish(ErrConnectionLimit)
+		return done
+	}
 	log.Debugf("DataChannel Opts: %#v\n", channel)
-	_, err := os.Stat(channel.Label())
-	if os.IsExist(err) {
-		log.Panicln("File with same name exists in current directory.")
+	sink := cfg.Sink
+	name := transfer.SafeFilename(channel.Label())
+	if sink == nil {
+		var overwrite bool
+		var err error
+		name, overwrite, err = receivedFileName(channel.Label(), cfg)
+		if err != nil {
+			receivers.release()
+			channel.Close()
+			finish(err)
+			return done
+		}
+		sink = fileSink{dir: cfg.Dir, overwrite: overwrite, fsync: cfg.Fsync}
 	}
-	c := askForConfirmation(fmt.Sprintf("Do you want to receive the file %s?", channel.Label()), os.Stdin)
-	if !c {
+	if !cfg.AutoAccept && !askForConfirmation(fmt.Sprintf("Do you want to receive the file %s?", name), stdinReader) {
 		fmt.Println("OK! Ignoring...")
-		return
+		receivers.release()
+		// Sender waits for the ready message, closing tells it to give up
+		channel.Close()
+		finish(ErrDeclined)
+		return done
 	}
 
-	var fd *os.File
-	fd, err = os.Create(channel.Label())
-	cobra.CheckErr(err)
+	out, err := sink.Create(name)
+	if err != nil {
+		receivers.release()
+		channel.Close()
+		finish(err)
+		return done
+	}
+	w := out
+	if cfg.Filter != nil {
+		w = cfg.Filter(w)
+	}
 	// Register the handlers
+	buffered := transfer.NewFlushWriter(w, receiveBufferSize, cfg.FlushInterval)
+	receiver := newFileReceiver(buffered, cfg.Framed)
+	started := time.Now()
+	// Accepted transfers end here, record how it went
+	finish = func(err error) {
+		once.Do(func() {
+			writeSummary(cfg.Summary, &transfer.Status{
+				Filename: name,
+				Size:     receiver.cw.BytesWritten(),
+				Started:  started,
+				Finished: time.Now(),
+				Checksum: receiver.cw.SumHex(),
+				Err:      err,
+			})
+			done <- err
+		})
+	}
+	// closeOutput flushes and closes the destination once, settleOutput
+	// commits or aborts it once: both the channel closing and a failure
+	// before that get there
+	var closeOnce, settleOnce sync.Once
+	var closeErr, settleErr error
+	closeOutput := func() error {
+		closeOnce.Do(func() {
+			closeErr = buffered.Close()
+			if cerr := w.Close(); closeErr == nil {
+				closeErr = cerr
+			}
+		})
+		return closeErr
+	}
+	settleOutput := func(err error) error {
+		settleOnce.Do(func() { settleErr = settle(out, err) })
+		return settleErr
+	}
+	release := sync.OnceFunc(receivers.release)
+	// failed is set when transfer is given up before the channel closes,
+	// remaining messages are dropped then
+	var failed atomic.Bool
+	// fail gives the transfer up and discards the partial file before
+	// reporting err, the caller may exit as soon as done gets it
+	fail := func(err error) {
+		failed.Store(true)
+		channel.Close()
+		closeOutput()
+		release()
+		finish(settleOutput(err))
+	}
+	watchdog := NewIdleWatchdog(cfg.IdleTimeout, func() {
+		fail(fmt.Errorf("%w (%s)", ErrIdleTimeout, cfg.IdleTimeout))
+	})
 	channel.OnMessage(func(msg webrtc.DataChannelMessage) {
+		watchdog.Activity()
 		// fmt.Printf("Message from DataChannel '%s': '%s'\n", channel.Label(), string(msg.Data))
-		fd.Write(msg.Data)
+		if failed.Load() {
+			return
+		}
+		// E.g. disk full, the rest of the file can't be saved either
+		if err := receiver.handleMessage(msg); err != nil {
+			fail(fmt.Errorf("failed to receive %s: %w", name, err))
+		}
+	})
+	// Tell the sender we're ready once the channel opens. Session.Receive may
+	// get the channel after it opened already, pion then runs OnOpen at once.
+	channel.OnOpen(func() {
+		watchdog.Start()
+		if err := channel.SendText(ReadyMessage); err != nil {
+			log.Errorln("Failed to notify sender:", err)
+		}
 	})
 	channel.OnClose(func() {
 		fmt.Printf("Data channel '%s'-'%d' closed. Transfering ended...\n", channel.Label(), channel.ID())
-		fd.Close()
-		os.Exit(0)
+		err := closeOutput()
+		release()
+		if err != nil {
+			err = fmt.Errorf("failed to save file: %w", err)
+		} else if verr := receiver.verify(); verr != nil {
+			err = fmt.Errorf("received file %s is corrupted: %w", name, verr)
+		} else if failed.Load() {
+			err = errors.New("transfer aborted")
+		}
+		// Partial or corrupted data never lands under the final name
+		finish(settleOutput(err))
 	})
+	return done
+}
+
+// writeSummary writes status to w unless it's nil
+func writeSummary(w io.Writer, status *transfer.Status) {
+	if w == nil {
+		return
+	}
+	if err := transfer.WriteSummary(w, status); err != nil {
+		log.Warnln("Failed to write transfer summary:", err)
+	}
+}
+
+// receivedFileName returns name in cfg.Dir to save file sent as label and
+// whether an existing file is replaced. Taken name is overwritten with Force
+// or when user agrees, otherwise renamed by CollisionFormat.
+func receivedFileName(label string, cfg Config) (string, bool, error) {
+	name := transfer.SafeFilename(label)
+	if name != label {
+		log.Warnf("Sender named file %q, saving as %q\n", label, name)
+	}
+	dir := cfg.Dir
+	if dir == "" {
+		dir = "."
+	}
+	if _, err := os.Lstat(filepath.Join(dir, name)); os.IsNotExist(err) {
+		return name, false, nil
+	} else if err != nil {
+		return "", false, err
+	}
+	if cfg.Force {
+		log.Warnf("Overwriting %s\n", name)
+		return name, true, nil
+	}
+	if !cfg.AutoAccept && askForConfirmation(fmt.Sprintf("File %s exists, overwrite it?", name), stdinReader) {
+		return name, true, nil
+	}
+	renamed, err := transfer.NextAvailableName(dir, name, cfg.CollisionFormat)
+	if err != nil {
+		return "", false, err
+	}
+	log.Infof("File %s exists, saving as %s\n", name, renamed)
+	return renamed, false, nil
 }
 
-func askForConfirmation(s string, in io.Reader) bool {
-	return true
+// askForConfirmation asks yes/no question, no answer on closed input is no
+func askForConfirmation(s string, reader *bufio.Reader) bool {
 	tries := 3
-	reader := bufio.NewReader(in)
 	for ; tries > 0; tries-- {
 		fmt.Printf("%s [y/n]: ", s)
 
 		res, err := reader.ReadString('\n')
-		if err != nil {
-			log.Fatal(err)
+		res = strings.ToLower(strings.TrimSpace(res))
+		if res != "" {
+			return res[0] == 'y'
 		}
-
-		// Empty input (i.e. "\n")
-		if len(res) < 2 {
-			continue
+		if err != nil {
+			log.Debugln("No answer:", err)
+			return false
 		}
-
-		return strings.ToLower(strings.TrimSpace(res))[0] == 'y'
+		// Empty input (i.e. "\n"), ask again
 	}
 
 	return false
@@ -0,0 +1,556 @@
+/*
+ *   Copyright (c) 2021 Anton Brekhov
+ *   All rights reserved.
+ */
+package datachannel
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+func TestSavedFileSyncsBeforeRename(t *testing.T) {
+	defer func(ds func(string) error, f func(*os.File) error) {
+		dirSyncer, fileSyncer = ds, f
+	}(dirSyncer, fileSyncer)
+
+	dir := t.TempDir()
+	dest := filepath.Join(dir, "received")
+	var calls []string
+	fileSyncer = func(fd *os.File) error {
+		if _, err := fd.Stat(); err != nil {
+			t.Errorf("file synced after close: %v", err)
+		}
+		calls = append(calls, "file")
+		return fd.Sync()
+	}
+	dirSyncer = func(d string) error {
+		if _, err := os.Stat(dest); err != nil {
+			t.Errorf("dir synced before rename: %v", err)
+		}
+		calls = append(calls, "dir:"+filepath.Base(d))
+		return nil
+	}
+
+	w, err := fileSink{dir: dir, fsync: true}.Create("received")
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(w, "data")
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.(Committer).Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != 2 || calls[0] != "file" || calls[1] != "dir:"+filepath.Base(dir) {
+		t.Errorf("calls = %v, want file sync then dir sync", calls)
+	}
+	if got, err := os.ReadFile(dest); err != nil || string(got) != "data" {
+		t.Errorf("saved %q, %v", got, err)
+	}
+	if partial, _ := filepath.Glob(filepath.Join(dir, "*"+partialSuffix)); len(partial) != 0 {
+		t.Errorf("temporary files left: %v", partial)
+	}
+}
+
+func TestSavedFileWithoutFsync(t *testing.T) {
+	defer func(ds func(string) error, f func(*os.File) error) {
+		dirSyncer, fileSyncer = ds, f
+	}(dirSyncer, fileSyncer)
+
+	fileSyncer = func(fd *os.File) error {
+		t.Error("file synced with Fsync disabled")
+		return nil
+	}
+	dirSyncer = func(string) error {
+		t.Error("dir synced with Fsync disabled")
+		return nil
+	}
+
+	w, err := fileSink{dir: t.TempDir()}.Create("received")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.(Committer).Commit(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// fakeReceiveChannel lets tests drive FileTransferHandler callbacks
+type fakeReceiveChannel struct {
+	mu        sync.Mutex
+	label     string
+	onOpen    func()
+	onClose   func()
+	onMessage func(msg webrtc.DataChannelMessage)
+	texts     []string
+	closed    bool
+}
+
+func (c *fakeReceiveChannel) Label() string { return c.label }
+func (c *fakeReceiveChannel) ID() *uint16   { return nil }
+func (c *fakeReceiveChannel) OnOpen(f func()) {
+	c.onOpen = f
+}
+func (c *fakeReceiveChannel) OnClose(f func()) {
+	c.onClose = f
+}
+func (c *fakeReceiveChannel) OnMessage(f func(msg webrtc.DataChannelMessage)) {
+	c.onMessage = f
+}
+
+func (c *fakeReceiveChannel) SendText(s string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.texts = append(c.texts, s)
+	return nil
+}
+
+func (c *fakeReceiveChannel) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	return nil
+}
+
+// withAnswers feeds answers to prompts for the rest of the test
+func withAnswers(t *testing.T, answers string) {
+	t.Helper()
+	reader := stdinReader
+	stdinReader = bufio.NewReader(strings.NewReader(answers))
+	t.Cleanup(func() { stdinReader = reader })
+}
+
+// receiveFile runs FileTransferHandler over fake channel delivering data
+func receiveFile(t *testing.T, label string, data []byte, cfg Config) error {
+	t.Helper()
+	channel := &fakeReceiveChannel{label: label}
+	done := FileTransferHandler(channel, cfg)
+	if channel.onOpen == nil {
+		return <-done
+	}
+	channel.onOpen()
+	channel.onMessage(webrtc.DataChannelMessage{Data: data})
+	channel.onMessage(footerMessage(t, data))
+	channel.onClose()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(time.Second):
+		t.Fatal("no done signal")
+	}
+	return nil
+}
+
+// inTempDir runs test in its own working directory, received files land there
+func inTempDir(t *testing.T) string {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	return dir
+}
+
+func TestFileTransferHandlerDone(t *testing.T) {
+	dir := inTempDir(t)
+	withAnswers(t, "y\n")
+	data := []byte("received without exiting the process")
+
+	channel := &fakeReceiveChannel{label: "note.txt"}
+	done := FileTransferHandler(channel, DefaultConfig())
+	channel.onOpen()
+	if len(channel.texts) != 1 || channel.texts[0] != ReadyMessage {
+		t.Fatalf("sent %q, want ready message", channel.texts)
+	}
+	channel.onMessage(webrtc.DataChannelMessage{Data: data})
+	channel.onMessage(footerMessage(t, data))
+	channel.onClose()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no done signal")
+	}
+	got, err := os.ReadFile(filepath.Join(dir, "note.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("saved %q, want %q", got, data)
+	}
+	if partial, _ := filepath.Glob(filepath.Join(dir, "*"+partialSuffix)); len(partial) != 0 {
+		t.Errorf("temporary files left: %v", partial)
+	}
+}
+
+func TestFileTransferHandlerCorruptedNotSaved(t *testing.T) {
+	dir := inTempDir(t)
+	cfg := DefaultConfig()
+	cfg.AutoAccept = true
+
+	channel := &fakeReceiveChannel{label: "broken.bin"}
+	done := FileTransferHandler(channel, cfg)
+	channel.onOpen()
+	channel.onMessage(webrtc.DataChannelMessage{Data: []byte("first half")})
+	// Footer of the complete file, the rest never came
+	channel.onMessage(footerMessage(t, []byte("first half, second half")))
+	channel.onClose()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("incomplete file reported as received")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no done signal")
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("failed transfer left %v, want nothing", entries)
+	}
+}
+
+// fullDisk fails every write with ENOSPC and records how it was settled
+type fullDisk struct {
+	writes  int
+	aborted bool
+}
+
+func (d *fullDisk) Create(name string) (io.WriteCloser, error) { return d, nil }
+func (d *fullDisk) Write(p []byte) (int, error) {
+	d.writes++
+	return 0, &os.PathError{Op: "write", Path: "full.bin", Err: syscall.ENOSPC}
+}
+func (d *fullDisk) Close() error  { return nil }
+func (d *fullDisk) Commit() error { return errors.New("committed after failed write") }
+func (d *fullDisk) Abort() error {
+	d.aborted = true
+	return nil
+}
+
+func TestFileTransferHandlerDiskFull(t *testing.T) {
+	inTempDir(t)
+	disk := &fullDisk{}
+	cfg := DefaultConfig()
+	cfg.AutoAccept = true
+	cfg.Sink = disk
+
+	channel := &fakeReceiveChannel{label: "full.bin"}
+	done := FileTransferHandler(channel, cfg)
+	channel.onOpen()
+	// Larger than the receive buffer, so it's written through at once
+	chunk := make([]byte, receiveBufferSize+1)
+	channel.onMessage(webrtc.DataChannelMessage{Data: chunk})
+	select {
+	case err := <-done:
+		if !errors.Is(err, syscall.ENOSPC) {
+			t.Errorf("err = %v, want ENOSPC", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("write failure didn't end the transfer")
+	}
+	// Discarded before done, the caller may exit without the channel closing
+	if !disk.aborted {
+		t.Error("partial file not discarded")
+	}
+	channel.mu.Lock()
+	closed := channel.closed
+	channel.mu.Unlock()
+	if !closed {
+		t.Error("channel left open after write failure")
+	}
+
+	writes := disk.writes
+	channel.onMessage(webrtc.DataChannelMessage{Data: chunk})
+	if disk.writes != writes {
+		t.Error("data written after failure")
+	}
+	channel.onClose()
+}
+
+// failingWriter passes Close through and fails every write with ENOSPC
+type failingWriter struct {
+	io.WriteCloser
+}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, syscall.ENOSPC
+}
+
+func TestFileTransferHandlerDiskFullRemovesPartial(t *testing.T) {
+	dir := inTempDir(t)
+	cfg := DefaultConfig()
+	cfg.AutoAccept = true
+	cfg.Filter = func(w io.WriteCloser) io.WriteCloser {
+		return failingWriter{w}
+	}
+
+	channel := &fakeReceiveChannel{label: "full.bin"}
+	done := FileTransferHandler(channel, cfg)
+	channel.onOpen()
+	channel.onMessage(webrtc.DataChannelMessage{Data: make([]byte, receiveBufferSize+1)})
+	select {
+	case err := <-done:
+		if !errors.Is(err, syscall.ENOSPC) {
+			t.Errorf("err = %v, want ENOSPC", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("write failure didn't end the transfer")
+	}
+	// The channel never closes here, like when the process exits on error
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("failed transfer left %v", entries)
+	}
+}
+
+func TestFileTransferHandlerSummary(t *testing.T) {
+	inTempDir(t)
+	var summary bytes.Buffer
+	cfg := DefaultConfig()
+	cfg.AutoAccept = true
+	cfg.Summary = &summary
+	data := []byte("logged transfer")
+
+	if err := receiveFile(t, "log.txt", data, cfg); err != nil {
+		t.Fatal(err)
+	}
+	var rec struct {
+		File     string `json:"file"`
+		Size     int64  `json:"size"`
+		Checksum string `json:"checksum"`
+		Success  bool   `json:"success"`
+	}
+	if err := json.Unmarshal(summary.Bytes(), &rec); err != nil {
+		t.Fatalf("summary %q: %v", summary.String(), err)
+	}
+	sum := sha256.Sum256(data)
+	if rec.File != "log.txt" || rec.Size != int64(len(data)) || rec.Checksum != hex.EncodeToString(sum[:]) || !rec.Success {
+		t.Errorf("summary = %+v", rec)
+	}
+}
+
+// memorySink keeps received files in memory
+type memorySink struct {
+	files map[string]*bytes.Buffer
+}
+
+func (s *memorySink) Create(name string) (io.WriteCloser, error) {
+	buf := &bytes.Buffer{}
+	s.files[name] = buf
+	return nopWriteCloser{buf}, nil
+}
+
+func TestFileTransferHandlerSink(t *testing.T) {
+	dir := inTempDir(t)
+	sink := &memorySink{files: map[string]*bytes.Buffer{}}
+	cfg := DefaultConfig()
+	cfg.AutoAccept = true
+	cfg.Sink = sink
+	data := []byte("kept off the disk")
+
+	if err := receiveFile(t, "../memory.txt", data, cfg); err != nil {
+		t.Fatal(err)
+	}
+	got, ok := sink.files["memory.txt"]
+	if !ok {
+		t.Fatalf("sink got %v, want memory.txt", sink.files)
+	}
+	if !bytes.Equal(got.Bytes(), data) {
+		t.Errorf("received %q, want %q", got.Bytes(), data)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("sink transfer touched disk: %v", entries)
+	}
+}
+
+// upperFilter upper-cases received data and records closing
+type upperFilter struct {
+	io.WriteCloser
+	closed *bool
+}
+
+func (f upperFilter) Write(p []byte) (int, error) {
+	return f.WriteCloser.Write(bytes.ToUpper(p))
+}
+
+func (f upperFilter) Close() error {
+	*f.closed = true
+	return f.WriteCloser.Close()
+}
+
+func TestFileTransferHandlerFilter(t *testing.T) {
+	inTempDir(t)
+	sink := &memorySink{files: map[string]*bytes.Buffer{}}
+	var closed bool
+	cfg := DefaultConfig()
+	cfg.AutoAccept = true
+	cfg.Sink = sink
+	cfg.Filter = func(w io.WriteCloser) io.WriteCloser {
+		return upperFilter{WriteCloser: w, closed: &closed}
+	}
+
+	if err := receiveFile(t, "filtered.txt", []byte("quiet"), cfg); err != nil {
+		t.Fatal(err)
+	}
+	if got := sink.files["filtered.txt"].String(); got != "QUIET" {
+		t.Errorf("saved %q, want filtered data", got)
+	}
+	if !closed {
+		t.Error("filter not closed")
+	}
+}
+
+func TestWriterSink(t *testing.T) {
+	var out bytes.Buffer
+	w, err := WriterSink{W: &out}.Create("any.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("data"))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "data" {
+		t.Errorf("wrote %q", out.String())
+	}
+}
+
+func TestFileTransferHandlerIdle(t *testing.T) {
+	dir := inTempDir(t)
+	withAnswers(t, "y\n")
+	cfg := DefaultConfig()
+	cfg.IdleTimeout = 20 * time.Millisecond
+
+	channel := &fakeReceiveChannel{label: "idle.bin"}
+	done := FileTransferHandler(channel, cfg)
+	channel.onOpen()
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrIdleTimeout) {
+			t.Errorf("err = %v, want ErrIdleTimeout", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("idle channel did not time out")
+	}
+	channel.mu.Lock()
+	closed := channel.closed
+	channel.mu.Unlock()
+	if !closed {
+		t.Error("idle channel left open")
+	}
+	// Removed before done, the channel may never report closing
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("abandoned transfer left %v", entries)
+	}
+	channel.onClose()
+}
+
+func TestFileTransferHandlerExistingFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		answers  string
+		force    bool
+		wantFile string
+	}{
+		{"overwrite confirmed", "y\ny\n", false, "exists.txt"},
+		{"overwrite refused", "n\ny\n", false, "exists (1).txt"},
+		{"force", "y\n", true, "exists.txt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := inTempDir(t)
+			withAnswers(t, tt.answers)
+			cfg := DefaultConfig()
+			cfg.Force = tt.force
+
+			if err := os.WriteFile("exists.txt", []byte("old content"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := receiveFile(t, "exists.txt", []byte("new"), cfg); err != nil {
+				t.Fatal(err)
+			}
+			got, err := os.ReadFile(filepath.Join(dir, tt.wantFile))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != "new" {
+				t.Errorf("%s = %q, want %q", tt.wantFile, got, "new")
+			}
+		})
+	}
+}
+
+func TestFileTransferHandlerDeclined(t *testing.T) {
+	inTempDir(t)
+	withAnswers(t, "n\n")
+	channel := &fakeReceiveChannel{label: "unwanted.bin"}
+	if err := <-FileTransferHandler(channel, DefaultConfig()); !errors.Is(err, ErrDeclined) {
+		t.Errorf("err = %v, want ErrDeclined", err)
+	}
+	if !channel.closed {
+		t.Error("declined channel left open, sender would wait for it")
+	}
+	if _, err := os.Stat("unwanted.bin"); !os.IsNotExist(err) {
+		t.Error("declined file was created")
+	}
+}
+
+func TestFileTransferHandlerTraversalLabel(t *testing.T) {
+	dir := inTempDir(t)
+	cfg := DefaultConfig()
+	cfg.AutoAccept = true
+
+	if err := os.Mkdir("inner", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir("inner"); err != nil {
+		t.Fatal(err)
+	}
+	if err := receiveFile(t, "../evil.txt", []byte("payload"), cfg); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "evil.txt")); !os.IsNotExist(err) {
+		t.Error("file escaped into parent directory")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "inner", "evil.txt")); err != nil {
+		t.Errorf("sanitized file not saved: %v", err)
+	}
+}
@@ -0,0 +1,48 @@
+/*
+ *   Copyright (c) 2021 Anton Brekhov
+ *   All rights reserved.
+ */
+package datachannel
+
+import (
+	"sync"
+	"time"
+)
+
+// IdleWatchdog calls onIdle when Activity isn't reported within timeout after
+// Start. It watches only the start of transfer, the first activity disarms it.
+type IdleWatchdog struct {
+	mu      sync.Mutex
+	timeout time.Duration
+	onIdle  func()
+	timer   *time.Timer
+	active  bool
+}
+
+// NewIdleWatchdog returns unarmed watchdog, timeout <= 0 disables it
+func NewIdleWatchdog(timeout time.Duration, onIdle func()) *IdleWatchdog {
+	return &IdleWatchdog{timeout: timeout, onIdle: onIdle}
+}
+
+// Start arms the watchdog, usually when channel opens
+func (w *IdleWatchdog) Start() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timeout <= 0 || w.active || w.timer != nil {
+		return
+	}
+	w.timer = time.AfterFunc(w.timeout, w.onIdle)
+}
+
+// Activity reports that data started to flow and disarms the watchdog
+func (w *IdleWatchdog) Activity() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.active {
+		return
+	}
+	w.active = true
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+}
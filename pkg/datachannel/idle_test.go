@@ -0,0 +1,41 @@
+/*
+ *   Copyright (c) 2021 Anton Brekhov
+ *   All rights reserved.
+ */
+package datachannel
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIdleWatchdogTimesOut(t *testing.T) {
+	idle := make(chan struct{})
+	w := NewIdleWatchdog(20*time.Millisecond, func() { close(idle) })
+	w.Start()
+	select {
+	case <-idle:
+	case <-time.After(time.Second):
+		t.Fatal("idle channel did not time out")
+	}
+}
+
+func TestIdleWatchdogActivity(t *testing.T) {
+	idle := make(chan struct{})
+	w := NewIdleWatchdog(20*time.Millisecond, func() { close(idle) })
+
+	// Data arriving before Start must not be missed
+	w.Activity()
+	w.Start()
+	select {
+	case <-idle:
+		t.Fatal("timed out despite activity")
+	case <-time.After(60 * time.Millisecond):
+	}
+}
+
+func TestIdleWatchdogDisabled(t *testing.T) {
+	w := NewIdleWatchdog(0, func() { t.Error("disabled watchdog fired") })
+	w.Start()
+	time.Sleep(10 * time.Millisecond)
+}
@@ -0,0 +1,36 @@
+/*
+ *   Copyright (c) 2021 Anton Brekhov
+ *   All rights reserved.
+ */
+package datachannel
+
+import "sync"
+
+// receivers counts incoming data channels being handled
+var receivers connectionLimit
+
+// connectionLimit is a counter of active connections with an upper bound
+type connectionLimit struct {
+	mu     sync.Mutex
+	active int
+}
+
+// acquire takes a slot unless max slots are taken. max <= 0 is unlimited.
+func (l *connectionLimit) acquire(max int) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if max > 0 && l.active >= max {
+		return false
+	}
+	l.active++
+	return true
+}
+
+// release frees slot taken by acquire
+func (l *connectionLimit) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.active > 0 {
+		l.active--
+	}
+}
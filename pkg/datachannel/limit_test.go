@@ -0,0 +1,46 @@
+/*
+ *   Copyright (c) 2021 Anton Brekhov
+ *   All rights reserved.
+ */
+package datachannel
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestConnectionLimitDeclinesOverLimit(t *testing.T) {
+	const max = 3
+	var l connectionLimit
+
+	var wg sync.WaitGroup
+	var accepted int32
+	for i := 0; i < max+1; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if l.acquire(max) {
+				atomic.AddInt32(&accepted, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	if accepted != max {
+		t.Fatalf("accepted %d channels, want %d", accepted, max)
+	}
+
+	l.release()
+	if !l.acquire(max) {
+		t.Error("slot not reusable after release")
+	}
+}
+
+func TestConnectionLimitUnlimited(t *testing.T) {
+	var l connectionLimit
+	for i := 0; i < 100; i++ {
+		if !l.acquire(0) {
+			t.Fatalf("channel %d declined without limit", i)
+		}
+	}
+}
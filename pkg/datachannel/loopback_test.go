@@ -0,0 +1,469 @@
+//go:build integration
+
+/*
+ *   Copyright (c) 2021 Anton Brekhov
+ *   All rights reserved.
+ */
+package datachannel
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pion/ice/v2"
+	"github.com/pion/webrtc/v3"
+)
+
+// loopbackPeer is one side of in-process ORTC connection over loopback
+type loopbackPeer struct {
+	api      *webrtc.API
+	gatherer *webrtc.ICEGatherer
+	ice      *webrtc.ICETransport
+	dtls     *webrtc.DTLSTransport
+	sctp     *webrtc.SCTPTransport
+	closed   sync.Once
+}
+
+func newLoopbackPeer(t testing.TB) *loopbackPeer {
+	t.Helper()
+	se := webrtc.SettingEngine{}
+	se.SetIncludeLoopbackCandidate(true)
+	se.SetNetworkTypes([]webrtc.NetworkType{webrtc.NetworkTypeUDP4})
+	se.SetICEMulticastDNSMode(ice.MulticastDNSModeDisabled)
+	api := webrtc.NewAPI(webrtc.WithSettingEngine(se))
+
+	gatherer, err := api.NewICEGatherer(webrtc.ICEGatherOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	iceTransport := api.NewICETransport(gatherer)
+	dtls, err := api.NewDTLSTransport(iceTransport, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &loopbackPeer{
+		api:      api,
+		gatherer: gatherer,
+		ice:      iceTransport,
+		dtls:     dtls,
+		sctp:     api.NewSCTPTransport(dtls),
+	}
+	t.Cleanup(p.close)
+	return p
+}
+
+// signal gathers candidates and returns local signal
+func (p *loopbackPeer) signal(t testing.TB) Signal {
+	t.Helper()
+	gatherFinished := make(chan struct{})
+	p.gatherer.OnLocalCandidate(func(c *webrtc.ICECandidate) {
+		if c == nil {
+			close(gatherFinished)
+		}
+	})
+	if err := p.gatherer.Gather(); err != nil {
+		t.Fatal(err)
+	}
+	<-gatherFinished
+
+	candidates, err := p.gatherer.GetLocalCandidates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	iceParams, err := p.gatherer.GetLocalParameters()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dtlsParams, err := p.dtls.GetLocalParameters()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Signal{
+		ICECandidates:    candidates,
+		ICEParameters:    iceParams,
+		DTLSParameters:   dtlsParams,
+		SCTPCapabilities: p.sctp.GetCapabilities(),
+	}
+}
+
+// start starts ICE, DTLS and SCTP transports against remote signal
+func (p *loopbackPeer) start(remote Signal, role webrtc.ICERole) error {
+	if err := remote.Validate(); err != nil {
+		return err
+	}
+	if err := p.ice.SetRemoteCandidates(remote.ICECandidates); err != nil {
+		return err
+	}
+	if err := p.ice.Start(p.gatherer, remote.ICEParameters, &role); err != nil {
+		return err
+	}
+	if err := p.dtls.Start(remote.DTLSParameters); err != nil {
+		return err
+	}
+	return p.sctp.Start(remote.SCTPCapabilities)
+}
+
+func (p *loopbackPeer) close() {
+	p.closed.Do(func() {
+		p.sctp.Stop()
+		p.dtls.Stop()
+		p.ice.Stop()
+		p.gatherer.Close()
+	})
+}
+
+// connectLoopback connects two peers, roles come from exchanged parameters
+func connectLoopback(t testing.TB, a, b *loopbackPeer) {
+	t.Helper()
+	connectLoopbackDelayed(t, a, b, 0)
+}
+
+// connectLoopbackDelayed starts a first and b after delay
+func connectLoopbackDelayed(t testing.TB, a, b *loopbackPeer, delay time.Duration) {
+	t.Helper()
+	sigA, sigB := a.signal(t), b.signal(t)
+	roleA, err := DetermineICERoleWithDTLS(sigA.ICEParameters, sigA.DTLSParameters, sigB.ICEParameters, sigB.DTLSParameters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roleB, err := DetermineICERoleWithDTLS(sigB.ICEParameters, sigB.DTLSParameters, sigA.ICEParameters, sigA.DTLSParameters)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		errs[0] = a.start(sigB, roleA)
+	}()
+	go func() {
+		defer wg.Done()
+		time.Sleep(delay)
+		errs[1] = b.start(sigA, roleB)
+	}()
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// openChannel creates ordered data channel labelled label on p
+func (p *loopbackPeer) openChannel(t testing.TB, label string) *webrtc.DataChannel {
+	t.Helper()
+	var id uint16 = 1
+	channel, err := p.api.NewDataChannel(p.sctp, &webrtc.DataChannelParameters{
+		Label:   label,
+		ID:      &id,
+		Ordered: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return channel
+}
+
+func TestLoopbackSendFile(t *testing.T) {
+	sender, receiver := newLoopbackPeer(t), newLoopbackPeer(t)
+	testLoopbackSendFile(t, sender, receiver, func() {
+		connectLoopback(t, sender, receiver)
+	})
+}
+
+func TestLoopbackReceiverStartsFirst(t *testing.T) {
+	sender, receiver := newLoopbackPeer(t), newLoopbackPeer(t)
+	testLoopbackSendFile(t, sender, receiver, func() {
+		connectLoopbackDelayed(t, receiver, sender, 500*time.Millisecond)
+	})
+}
+
+// testLoopbackSendFile sends random file from sender to receiver after connect
+func testLoopbackSendFile(t *testing.T, sender, receiver *loopbackPeer, connect func()) {
+	data := make([]byte, 4*1024*1024+17)
+	rand.Read(data)
+
+	received := loopbackTransfer(t, sender, receiver, data, DefaultChunkSize, connect)
+	if !bytes.Equal(received, data) {
+		t.Errorf("received %d bytes, want %d identical bytes", len(received), len(data))
+	}
+}
+
+// loopbackTransfer sends data from sender to receiver after connect and
+// returns what receiver got
+func loopbackTransfer(tb testing.TB, sender, receiver *loopbackPeer, data []byte, chunkSize int, connect func()) []byte {
+	tb.Helper()
+	var received bytes.Buffer
+	done := make(chan struct{})
+	receiver.sctp.OnDataChannel(func(channel *webrtc.DataChannel) {
+		channel.OnMessage(func(msg webrtc.DataChannelMessage) {
+			received.Write(msg.Data)
+		})
+		channel.OnClose(func() {
+			close(done)
+		})
+	})
+	connect()
+
+	channel := sender.openChannel(tb, "payload.bin")
+	sendErr := make(chan error, 1)
+	channel.OnOpen(func() {
+		_, err := SendFile(channel, bytes.NewReader(data), chunkSize)
+		channel.Close()
+		sendErr <- err
+	})
+
+	select {
+	case err := <-sendErr:
+		if err != nil {
+			tb.Fatal(err)
+		}
+	case <-time.After(30 * time.Second):
+		tb.Fatal("send timed out")
+	}
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		tb.Fatal("receiver channel not closed")
+	}
+	return received.Bytes()
+}
+
+// BenchmarkLoopbackTransfer measures throughput of SendFile over loopback
+// connection by chunk size, connection setup is not timed. Files need
+// ordered channels, unordered delivery reorders chunks and isn't measured.
+// Run it with go test -tags integration -run '^$' -bench Loopback ./pkg/datachannel
+func BenchmarkLoopbackTransfer(b *testing.B) {
+	if testing.Short() {
+		b.Skip("loopback transfers are slow in short mode")
+	}
+	data := make([]byte, 16*1024*1024)
+	rand.Read(data)
+
+	for _, chunkSize := range []int{1024, 16384, DefaultChunkSize} {
+		b.Run(fmt.Sprintf("chunk=%d", chunkSize), func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				sender, receiver := newLoopbackPeer(b), newLoopbackPeer(b)
+				received := loopbackTransfer(b, sender, receiver, data, chunkSize, func() {
+					connectLoopback(b, sender, receiver)
+					b.StartTimer()
+				})
+				b.StopTimer()
+				if !bytes.Equal(received, data) {
+					b.Fatalf("received %d bytes, want %d identical bytes", len(received), len(data))
+				}
+				// Free sockets before the next connection
+				sender.close()
+				receiver.close()
+			}
+		})
+	}
+}
+
+// newLoopbackSession creates session connecting over loopback only
+func newLoopbackSession(t *testing.T, cfg SessionConfig) *Session {
+	t.Helper()
+	se := webrtc.SettingEngine{}
+	se.SetIncludeLoopbackCandidate(true)
+	se.SetNetworkTypes([]webrtc.NetworkType{webrtc.NetworkTypeUDP4})
+	se.SetICEMulticastDNSMode(ice.MulticastDNSModeDisabled)
+	s, err := NewSession(webrtc.NewAPI(webrtc.WithSettingEngine(se)), webrtc.ICEGatherOptions{}, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// connectSessions creates sender and receiver sessions with receiverCfg and
+// connects them, both apply the remote signal at once
+func connectSessions(t *testing.T, receiverCfg SessionConfig) (*Session, *Session) {
+	t.Helper()
+	sender, receiver := newLoopbackSession(t, DefaultSessionConfig()), newLoopbackSession(t, receiverCfg)
+	senderSignal, err := sender.LocalSignal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	receiverSignal, err := receiver.LocalSignal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		errs[0] = sender.SetRemoteSignal(receiverSignal)
+	}()
+	go func() {
+		defer wg.Done()
+		errs[1] = receiver.SetRemoteSignal(senderSignal)
+	}()
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return sender, receiver
+}
+
+// sessionTransfer sends data as file name from sender to receiver and returns
+// path of the received file
+func sessionTransfer(t *testing.T, sender, receiver *Session, name string, data []byte) string {
+	t.Helper()
+	src := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(src, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	dest := t.TempDir()
+	received := make(chan error, 1)
+	go func() {
+		received <- receiver.Receive(dest)
+	}()
+	sent := make(chan error, 1)
+	go func() {
+		sent <- sender.SendFile(src)
+	}()
+
+	select {
+	case err := <-received:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(30 * time.Second):
+		t.Fatal("receive timed out")
+	}
+	// Sender is done once the receiver goes away
+	receiver.Close()
+	select {
+	case err := <-sent:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(30 * time.Second):
+		t.Fatal("sender didn't finish after receiver left")
+	}
+	return filepath.Join(dest, name)
+}
+
+// autoAccept is receiver configuration of session tests
+func autoAccept() SessionConfig {
+	cfg := DefaultSessionConfig()
+	cfg.Transfer.AutoAccept = true
+	return cfg
+}
+
+func TestLoopbackSession(t *testing.T) {
+	sender, receiver := connectSessions(t, autoAccept())
+	if !sender.Agreement().Framing {
+		t.Error("sessions didn't agree on framing")
+	}
+
+	data := make([]byte, 1024*1024+3)
+	rand.Read(data)
+	got, err := os.ReadFile(sessionTransfer(t, sender, receiver, "session.bin", data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("received %d bytes, want %d identical bytes", len(got), len(data))
+	}
+}
+
+func TestLoopbackSessionEmptyFile(t *testing.T) {
+	var summary bytes.Buffer
+	cfg := autoAccept()
+	cfg.Transfer.Summary = &summary
+	sender, receiver := connectSessions(t, cfg)
+
+	dest := sessionTransfer(t, sender, receiver, "empty.bin", nil)
+	info, err := os.Stat(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != 0 {
+		t.Errorf("received %d bytes, want empty file", info.Size())
+	}
+	// Receiver verified the footer, the summary has the checksum it matched
+	var rec struct {
+		Checksum string `json:"checksum"`
+		Success  bool   `json:"success"`
+	}
+	if err := json.Unmarshal(summary.Bytes(), &rec); err != nil {
+		t.Fatalf("summary %q: %v", summary.String(), err)
+	}
+	empty := sha256.Sum256(nil)
+	if !rec.Success || rec.Checksum != hex.EncodeToString(empty[:]) {
+		t.Errorf("summary = %+v, want success with checksum of empty input", rec)
+	}
+}
+
+func TestLoopbackSessionDeclinesUnexpectedChannels(t *testing.T) {
+	sender, receiver := connectSessions(t, autoAccept())
+
+	// Sender never calls Receive, channels beyond the queue are closed
+	// instead of blocking its SCTP transport
+	closed := make(chan string, 1)
+	for i := 0; i <= incomingChannels; i++ {
+		label := fmt.Sprintf("unexpected-%d", i)
+		id := uint16(100 + 2*i)
+		channel, err := receiver.api.NewDataChannel(receiver.sctp, &webrtc.DataChannelParameters{Label: label, ID: &id, Ordered: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		channel.OnClose(func() {
+			select {
+			case closed <- label:
+			default:
+			}
+		})
+	}
+	select {
+	case label := <-closed:
+		if label != fmt.Sprintf("unexpected-%d", incomingChannels) {
+			t.Errorf("closed %s, want the channel beyond the queue", label)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("channel beyond the queue wasn't closed")
+	}
+
+	// The sending side still works
+	dest := sessionTransfer(t, sender, receiver, "after.bin", []byte("still works"))
+	if data, err := os.ReadFile(dest); err != nil || string(data) != "still works" {
+		t.Errorf("received %q, %v", data, err)
+	}
+}
+
+func TestLoopbackSessionAcceptTimeout(t *testing.T) {
+	sender, _ := connectSessions(t, autoAccept())
+	// Idle timeout is about data flow, it must not cut the wait for accept short
+	sender.cfg.Transfer.IdleTimeout = 10 * time.Millisecond
+	sender.cfg.AcceptTimeout = 300 * time.Millisecond
+
+	// Receiver never calls Receive, like a user not answering the prompt
+	start := time.Now()
+	_, err := sender.Send("unanswered.bin", bytes.NewReader([]byte("data")))
+	if !errors.Is(err, ErrNotAccepted) {
+		t.Fatalf("err = %v, want ErrNotAccepted", err)
+	}
+	if waited := time.Since(start); waited < sender.cfg.AcceptTimeout {
+		t.Errorf("gave up after %s, want at least %s", waited, sender.cfg.AcceptTimeout)
+	}
+}
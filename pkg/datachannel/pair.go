@@ -0,0 +1,52 @@
+/*
+ *   Copyright (c) 2021 Anton Brekhov
+ *   All rights reserved.
+ */
+package datachannel
+
+import "github.com/pion/webrtc/v3"
+
+// PairType tells whether selected candidate pair goes directly between peers
+// or through TURN relays
+type PairType int
+
+const (
+	// PairUnknown is reported when there is no selected pair yet
+	PairUnknown PairType = iota
+	// PairDirect connects peers without relays
+	PairDirect
+	// PairHalfRelayed goes through TURN relay of one peer
+	PairHalfRelayed
+	// PairRelayed goes through TURN relays of both peers
+	PairRelayed
+)
+
+func (t PairType) String() string {
+	switch t {
+	case PairDirect:
+		return "direct"
+	case PairHalfRelayed:
+		return "relayed on one side"
+	case PairRelayed:
+		return "relayed"
+	default:
+		return "unknown"
+	}
+}
+
+// ClassifyPair returns how selected candidate pair connects peers
+func ClassifyPair(pair *webrtc.ICECandidatePair) PairType {
+	if pair == nil || pair.Local == nil || pair.Remote == nil {
+		return PairUnknown
+	}
+	localRelay := pair.Local.Typ == webrtc.ICECandidateTypeRelay
+	remoteRelay := pair.Remote.Typ == webrtc.ICECandidateTypeRelay
+	switch {
+	case localRelay && remoteRelay:
+		return PairRelayed
+	case localRelay || remoteRelay:
+		return PairHalfRelayed
+	default:
+		return PairDirect
+	}
+}
@@ -0,0 +1,39 @@
+/*
+ *   Copyright (c) 2021 Anton Brekhov
+ *   All rights reserved.
+ */
+package datachannel
+
+import (
+	"testing"
+
+	"github.com/pion/webrtc/v3"
+)
+
+func TestClassifyPair(t *testing.T) {
+	host := &webrtc.ICECandidate{Typ: webrtc.ICECandidateTypeHost}
+	srflx := &webrtc.ICECandidate{Typ: webrtc.ICECandidateTypeSrflx}
+	prflx := &webrtc.ICECandidate{Typ: webrtc.ICECandidateTypePrflx}
+	relay := &webrtc.ICECandidate{Typ: webrtc.ICECandidateTypeRelay}
+
+	tests := []struct {
+		name string
+		pair *webrtc.ICECandidatePair
+		want PairType
+	}{
+		{"no pair", nil, PairUnknown},
+		{"missing remote", &webrtc.ICECandidatePair{Local: host}, PairUnknown},
+		{"host-host", webrtc.NewICECandidatePair(host, host), PairDirect},
+		{"srflx-prflx", webrtc.NewICECandidatePair(srflx, prflx), PairDirect},
+		{"relay-srflx", webrtc.NewICECandidatePair(relay, srflx), PairHalfRelayed},
+		{"host-relay", webrtc.NewICECandidatePair(host, relay), PairHalfRelayed},
+		{"relay-relay", webrtc.NewICECandidatePair(relay, relay), PairRelayed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ClassifyPair(tt.pair); got != tt.want {
+				t.Errorf("ClassifyPair = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,19 @@
+/*
+ *   Copyright (c) 2021 Anton Brekhov
+ *   All rights reserved.
+ */
+package datachannel
+
+import (
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// SignalQR renders encoded signal as QR code drawn with unicode half blocks,
+// so it fits a terminal and can be scanned from the screen
+func SignalQR(signal string) (string, error) {
+	q, err := qrcode.New(signal, qrcode.Low)
+	if err != nil {
+		return "", err
+	}
+	return q.ToSmallString(false), nil
+}
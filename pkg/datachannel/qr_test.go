@@ -0,0 +1,35 @@
+/*
+ *   Copyright (c) 2021 Anton Brekhov
+ *   All rights reserved.
+ */
+package datachannel
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pion/webrtc/v3"
+)
+
+func TestSignalQR(t *testing.T) {
+	signal, err := EncodeSignal(Signal{
+		ICEParameters: webrtc.ICEParameters{UsernameFragment: "ufrag", Password: "password"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	qr, err := SignalQR(signal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(qr), "\n")
+	if len(lines) < 10 {
+		t.Errorf("QR code has %d lines, too small for the signal", len(lines))
+	}
+}
+
+func TestSignalQRTooLong(t *testing.T) {
+	if _, err := SignalQR(strings.Repeat("A", 8000)); err == nil {
+		t.Error("expected error for signal exceeding QR capacity")
+	}
+}
@@ -0,0 +1,55 @@
+/*
+ *   Copyright (c) 2021 Anton Brekhov
+ *   All rights reserved.
+ */
+package datachannel
+
+import (
+	"bytes"
+	"sync"
+
+	"github.com/pion/webrtc/v3"
+	log "github.com/sirupsen/logrus"
+)
+
+// ReadyMessage is sent by the receiver after it accepted the transfer
+const ReadyMessage = "HT_READY:"
+
+// IsReadyMessage checks whether data channel message is receiver readiness
+func IsReadyMessage(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(ReadyMessage))
+}
+
+// ReadyGate blocks the sender until the receiver reports it's ready, so file
+// data never races the accept prompt on the other side.
+type ReadyGate struct {
+	once  sync.Once
+	ready chan struct{}
+}
+
+// NewReadyGate creates closed gate
+func NewReadyGate() *ReadyGate {
+	return &ReadyGate{ready: make(chan struct{})}
+}
+
+// HandleMessage opens the gate on ReadyMessage. Use it as OnMessage handler.
+func (g *ReadyGate) HandleMessage(msg webrtc.DataChannelMessage) {
+	if !IsReadyMessage(msg.Data) {
+		log.Debugf("Unexpected message from receiver: %q\n", msg.Data)
+		return
+	}
+	g.once.Do(func() {
+		log.Debugln("Receiver is ready")
+		close(g.ready)
+	})
+}
+
+// Ready returns channel closed once the receiver is ready
+func (g *ReadyGate) Ready() <-chan struct{} {
+	return g.ready
+}
+
+// Wait blocks until the receiver is ready
+func (g *ReadyGate) Wait() {
+	<-g.ready
+}
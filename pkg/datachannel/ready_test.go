@@ -0,0 +1,53 @@
+/*
+ *   Copyright (c) 2021 Anton Brekhov
+ *   All rights reserved.
+ */
+package datachannel
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+func TestReadyGateBlocksUntilReady(t *testing.T) {
+	gate := NewReadyGate()
+	var sent atomic.Int32
+	done := make(chan struct{})
+	go func() {
+		gate.Wait()
+		sent.Add(1)
+		close(done)
+	}()
+
+	// Non-ready messages must not open the gate
+	gate.HandleMessage(webrtc.DataChannelMessage{IsString: true, Data: []byte("hello")})
+	time.Sleep(50 * time.Millisecond)
+	if sent.Load() != 0 {
+		t.Fatal("data sent before receiver was ready")
+	}
+
+	gate.HandleMessage(webrtc.DataChannelMessage{IsString: true, Data: []byte(ReadyMessage)})
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("sender not released after ready message")
+	}
+
+	// Duplicate ready messages are harmless
+	gate.HandleMessage(webrtc.DataChannelMessage{IsString: true, Data: []byte(ReadyMessage)})
+	if sent.Load() != 1 {
+		t.Errorf("sent = %d, want 1", sent.Load())
+	}
+}
+
+func TestIsReadyMessage(t *testing.T) {
+	if !IsReadyMessage([]byte(ReadyMessage)) {
+		t.Error("ReadyMessage not recognized")
+	}
+	if IsReadyMessage([]byte("HT_READ")) {
+		t.Error("partial prefix recognized as ready")
+	}
+}
@@ -0,0 +1,81 @@
+/*
+ *   Copyright (c) 2021 Anton Brekhov
+ *   All rights reserved.
+ */
+package datachannel
+
+import (
+	"io"
+
+	"github.com/abrekhov/hypertunnel/pkg/transfer"
+	"github.com/pion/webrtc/v3"
+	log "github.com/sirupsen/logrus"
+)
+
+// fileReceiver writes data messages and keeps the footer sent after them
+type fileReceiver struct {
+	cw     *transfer.ChecksumWriter
+	footer *transfer.Footer
+	// framed senders send every message as frame
+	framed bool
+}
+
+func newFileReceiver(w io.Writer, framed bool) *fileReceiver {
+	return &fileReceiver{cw: transfer.NewChecksumWriter(w), framed: framed}
+}
+
+// handleMessage writes data, footer comes as text message or metadata frame
+func (r *fileReceiver) handleMessage(msg webrtc.DataChannelMessage) error {
+	if r.framed {
+		return r.handleFrame(msg)
+	}
+	if !msg.IsString {
+		_, err := r.cw.Write(msg.Data)
+		return err
+	}
+	if !transfer.IsFooter(string(msg.Data)) {
+		log.Debugf("Ignoring text message: %q\n", msg.Data)
+		return nil
+	}
+	return r.handleFooter(string(msg.Data))
+}
+
+func (r *fileReceiver) handleFrame(msg webrtc.DataChannelMessage) error {
+	if msg.IsString {
+		log.Debugf("Ignoring text message: %q\n", msg.Data)
+		return nil
+	}
+	t, payload, err := ParseMessage(msg.Data)
+	if err != nil {
+		return err
+	}
+	switch t {
+	case FrameData:
+		_, err := r.cw.Write(payload)
+		return err
+	case FrameMetadata:
+		return r.handleFooter(string(payload))
+	default:
+		log.Debugf("Ignoring frame of type %d\n", t)
+		return nil
+	}
+}
+
+func (r *fileReceiver) handleFooter(msg string) error {
+	footer, err := transfer.ParseFooter(msg)
+	if err != nil {
+		return err
+	}
+	r.footer = &footer
+	return nil
+}
+
+// verify checks received data against the footer. Older senders send no
+// footer, their files are accepted unverified.
+func (r *fileReceiver) verify() error {
+	if r.footer == nil {
+		log.Warnln("Sender sent no checksum, received file is not verified")
+		return nil
+	}
+	return r.footer.Verify(r.cw)
+}
@@ -0,0 +1,99 @@
+/*
+ *   Copyright (c) 2021 Anton Brekhov
+ *   All rights reserved.
+ */
+package datachannel
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/abrekhov/hypertunnel/pkg/transfer"
+	"github.com/pion/webrtc/v3"
+)
+
+func footerMessage(t *testing.T, data []byte) webrtc.DataChannelMessage {
+	t.Helper()
+	cw := transfer.NewChecksumWriter(io.Discard)
+	cw.Write(data)
+	msg, err := transfer.EncodeFooter(transfer.NewFooter(cw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return webrtc.DataChannelMessage{IsString: true, Data: []byte(msg)}
+}
+
+func TestFileReceiverFooter(t *testing.T) {
+	data := []byte("streamed file of unknown size")
+
+	t.Run("verified", func(t *testing.T) {
+		var out bytes.Buffer
+		r := newFileReceiver(&out, false)
+		r.handleMessage(webrtc.DataChannelMessage{Data: data[:10]})
+		r.handleMessage(webrtc.DataChannelMessage{Data: data[10:]})
+		r.handleMessage(footerMessage(t, data))
+		if err := r.verify(); err != nil {
+			t.Error(err)
+		}
+		if !bytes.Equal(out.Bytes(), data) {
+			t.Errorf("written %q, want %q", out.Bytes(), data)
+		}
+	})
+	t.Run("corrupted", func(t *testing.T) {
+		r := newFileReceiver(io.Discard, false)
+		r.handleMessage(webrtc.DataChannelMessage{Data: []byte("STREAMED file of unknown size")})
+		r.handleMessage(footerMessage(t, data))
+		if err := r.verify(); !errors.Is(err, transfer.ErrChecksumMismatch) {
+			t.Errorf("err = %v, want ErrChecksumMismatch", err)
+		}
+	})
+	t.Run("no footer", func(t *testing.T) {
+		r := newFileReceiver(io.Discard, false)
+		r.handleMessage(webrtc.DataChannelMessage{Data: data})
+		if err := r.verify(); err != nil {
+			t.Errorf("sender without footer: %v", err)
+		}
+	})
+}
+
+func TestFileReceiverFramed(t *testing.T) {
+	// File content looking like the old footer is still data
+	data := []byte(`HT_FOOT:{"algorithm":"sha256","checksum":"00","size":1}`)
+	footer := footerMessage(t, data)
+
+	var out bytes.Buffer
+	r := newFileReceiver(&out, true)
+	for _, frame := range [][]byte{
+		FrameMessage(FrameData, data[:8]),
+		FrameMessage(FrameData, data[8:]),
+		FrameMessage(FrameMetadata, footer.Data),
+	} {
+		if err := r.handleMessage(webrtc.DataChannelMessage{Data: frame}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !bytes.Equal(out.Bytes(), data) {
+		t.Errorf("written %q, want %q", out.Bytes(), data)
+	}
+	if r.footer == nil {
+		t.Fatal("footer frame not recognized")
+	}
+	if err := r.verify(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFileReceiverUnframedPrefixData(t *testing.T) {
+	// Binary messages are data even when they start with the footer prefix
+	data := []byte(transfer.FooterPrefix + "not a footer")
+	var out bytes.Buffer
+	r := newFileReceiver(&out, false)
+	if err := r.handleMessage(webrtc.DataChannelMessage{Data: data}); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Bytes(), data) || r.footer != nil {
+		t.Errorf("written %q, footer %+v", out.Bytes(), r.footer)
+	}
+}
@@ -0,0 +1,64 @@
+/*
+ *   Copyright (c) 2021 Anton Brekhov
+ *   All rights reserved.
+ */
+package datachannel
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// ErrSameSignal is returned when remote parameters equal local ones, which
+// happens when own signal is pasted back
+var ErrSameSignal = errors.New("remote signal is identical to local one, paste the signal of the other side")
+
+// DetermineICERole picks ICE role from exchanged parameters alone, so it
+// doesn't matter which peer started first: peer with greater username
+// fragment is controlling. Equal fragments are broken by password, then a
+// full agent controls a lite one. Only identical parameters give controlled
+// to both.
+func DetermineICERole(local, remote webrtc.ICEParameters) webrtc.ICERole {
+	if iceParametersLess(remote, local) {
+		return webrtc.ICERoleControlling
+	}
+	return webrtc.ICERoleControlled
+}
+
+// iceParametersLess orders parameters by ufrag, password and lite flag
+func iceParametersLess(a, b webrtc.ICEParameters) bool {
+	if a.UsernameFragment != b.UsernameFragment {
+		return a.UsernameFragment < b.UsernameFragment
+	}
+	if a.Password != b.Password {
+		return a.Password < b.Password
+	}
+	return a.ICELite && !b.ICELite
+}
+
+// DetermineICERoleWithDTLS is DetermineICERole which breaks ties of identical
+// ICE parameters by comparing DTLS fingerprints, so peers always get opposite
+// roles
+func DetermineICERoleWithDTLS(localICE webrtc.ICEParameters, localDTLS webrtc.DTLSParameters, remoteICE webrtc.ICEParameters, remoteDTLS webrtc.DTLSParameters) (webrtc.ICERole, error) {
+	if localICE != remoteICE {
+		return DetermineICERole(localICE, remoteICE), nil
+	}
+	switch strings.Compare(fingerprintsKey(localDTLS), fingerprintsKey(remoteDTLS)) {
+	case 1:
+		return webrtc.ICERoleControlling, nil
+	case -1:
+		return webrtc.ICERoleControlled, nil
+	}
+	return webrtc.ICERole(webrtc.Unknown), ErrSameSignal
+}
+
+func fingerprintsKey(params webrtc.DTLSParameters) string {
+	var b strings.Builder
+	for _, fp := range params.Fingerprints {
+		b.WriteString(fp.Algorithm)
+		b.WriteString(fp.Value)
+	}
+	return b.String()
+}
@@ -0,0 +1,69 @@
+/*
+ *   Copyright (c) 2021 Anton Brekhov
+ *   All rights reserved.
+ */
+package datachannel
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/pion/webrtc/v3"
+)
+
+func TestDetermineICERole(t *testing.T) {
+	a := webrtc.ICEParameters{UsernameFragment: "bbbb", Password: "pa"}
+	b := webrtc.ICEParameters{UsernameFragment: "aaaa", Password: "pb"}
+
+	t.Run("greater ufrag controls", func(t *testing.T) {
+		if got := DetermineICERole(a, b); got != webrtc.ICERoleControlling {
+			t.Errorf("role = %s, want controlling", got)
+		}
+		if got := DetermineICERole(b, a); got != webrtc.ICERoleControlled {
+			t.Errorf("role = %s, want controlled", got)
+		}
+	})
+	t.Run("equal ufrag gives opposite roles", func(t *testing.T) {
+		c := webrtc.ICEParameters{UsernameFragment: a.UsernameFragment, Password: "pc"}
+		if DetermineICERole(a, c) == DetermineICERole(c, a) {
+			t.Errorf("both peers got %s", DetermineICERole(a, c))
+		}
+	})
+	t.Run("full agent controls lite one", func(t *testing.T) {
+		lite := a
+		lite.ICELite = true
+		if got := DetermineICERole(a, lite); got != webrtc.ICERoleControlling {
+			t.Errorf("role = %s, want controlling", got)
+		}
+		if got := DetermineICERole(lite, a); got != webrtc.ICERoleControlled {
+			t.Errorf("role = %s, want controlled", got)
+		}
+	})
+	t.Run("identical parameters default to controlled", func(t *testing.T) {
+		if got := DetermineICERole(a, a); got != webrtc.ICERoleControlled {
+			t.Errorf("role = %s, want controlled", got)
+		}
+	})
+}
+
+func TestDetermineICERoleWithDTLS(t *testing.T) {
+	ice := webrtc.ICEParameters{UsernameFragment: "same", Password: "pw"}
+	dtlsA := webrtc.DTLSParameters{Fingerprints: []webrtc.DTLSFingerprint{{Algorithm: "sha-256", Value: "AA:BB"}}}
+	dtlsB := webrtc.DTLSParameters{Fingerprints: []webrtc.DTLSFingerprint{{Algorithm: "sha-256", Value: "CC:DD"}}}
+
+	roleA, err := DetermineICERoleWithDTLS(ice, dtlsA, ice, dtlsB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roleB, err := DetermineICERoleWithDTLS(ice, dtlsB, ice, dtlsA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if roleA == roleB {
+		t.Errorf("both peers got %s on ufrag tie", roleA)
+	}
+
+	if _, err := DetermineICERoleWithDTLS(ice, dtlsA, ice, dtlsA); !errors.Is(err, ErrSameSignal) {
+		t.Errorf("err = %v, want ErrSameSignal", err)
+	}
+}
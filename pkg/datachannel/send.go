@@ -0,0 +1,145 @@
+/*
+ *   Copyright (c) 2021 Anton Brekhov
+ *   All rights reserved.
+ */
+package datachannel
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/abrekhov/hypertunnel/pkg/transfer"
+	"github.com/pion/webrtc/v3"
+	log "github.com/sirupsen/logrus"
+)
+
+// Flow control thresholds of SCTP send buffer
+const (
+	// DefaultChunkSize is the largest message WebRTC peers accept safely
+	DefaultChunkSize = 65534
+	// minChunkSize is the smallest peer max message size worth sending with
+	minChunkSize = 1024
+	// maxBufferedAmount pauses sending when that much data is queued
+	maxBufferedAmount = 1 << 20
+	// bufferedAmountLow resumes sending once queue drained below it
+	bufferedAmountLow = 512 * 1024
+	// drainPoll is a fallback when OnBufferedAmountLow event is missed
+	drainPoll = 100 * time.Millisecond
+)
+
+// ErrChannelClosed is returned when channel closes before everything is sent
+var ErrChannelClosed = errors.New("data channel closed before transfer completed")
+
+// Sender is the part of webrtc.DataChannel used to send files
+type Sender interface {
+	Send(data []byte) error
+	ReadyState() webrtc.DataChannelState
+	BufferedAmount() uint64
+	SetBufferedAmountLowThreshold(th uint64)
+	OnBufferedAmountLow(f func())
+}
+
+// ClampChunkSize returns chunkSize reduced to the max message size the peer
+// accepts. MaxMessageSize 0 means the peer doesn't limit it. Limits below 1KB
+// are rejected, sending in such tiny messages isn't worth it.
+func ClampChunkSize(chunkSize int, remote webrtc.SCTPCapabilities) (int, error) {
+	if chunkSize <= 0 {
+		return 0, fmt.Errorf("chunk size must be positive, got %d", chunkSize)
+	}
+	max := remote.MaxMessageSize
+	if max == 0 || uint64(chunkSize) <= uint64(max) {
+		return chunkSize, nil
+	}
+	if max < minChunkSize {
+		return 0, fmt.Errorf("peer max message size %d is too small, need at least %d", max, minChunkSize)
+	}
+	log.Infof("Peer accepts messages up to %d bytes, sending %d byte chunks instead of %d\n", max, max, chunkSize)
+	return int(max), nil
+}
+
+// TextSender is Sender which also sends text messages
+type TextSender interface {
+	Sender
+	SendText(s string) error
+}
+
+// SendFile streams r into channel in chunkSize messages. Sending pauses while
+// more than 1MB waits in SCTP buffer, so slow receivers don't blow up sender
+// memory. It returns after all data was acknowledged by the receiver.
+func SendFile(channel Sender, r io.Reader, chunkSize int) (int64, error) {
+	drained := make(chan struct{}, 1)
+	channel.SetBufferedAmountLowThreshold(bufferedAmountLow)
+	channel.OnBufferedAmountLow(func() {
+		select {
+		case drained <- struct{}{}:
+		default:
+		}
+	})
+
+	chunk := make([]byte, chunkSize)
+	var sent int64
+	for {
+		n, err := io.ReadFull(r, chunk)
+		if n > 0 {
+			if err := waitBuffered(channel, drained, maxBufferedAmount); err != nil {
+				return sent, err
+			}
+			if err := channel.Send(chunk[:n]); err != nil {
+				return sent, err
+			}
+			sent += int64(n)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return sent, err
+		}
+	}
+	// Closing with unacknowledged chunks may drop them
+	return sent, waitBuffered(channel, drained, 0)
+}
+
+// SendFileWithFooter is SendFile followed by transfer.Footer with checksum and
+// size of the sent data, so receiver can verify streams of unknown size
+func SendFileWithFooter(channel TextSender, r io.Reader, chunkSize int) (int64, error) {
+	cw := transfer.NewChecksumWriter(io.Discard)
+	sent, err := SendFile(channel, io.TeeReader(r, cw), chunkSize)
+	if err != nil {
+		return sent, err
+	}
+	msg, err := transfer.EncodeFooter(transfer.NewFooter(cw))
+	if err != nil {
+		return sent, err
+	}
+	if err := channel.SendText(msg); err != nil {
+		return sent, err
+	}
+	return sent, waitBuffered(channel, nil, 0)
+}
+
+// SendFileFramed is SendFileWithFooter for receivers which agreed on framing:
+// every message is a frame, so messages stay at most chunkSize bytes
+func SendFileFramed(channel TextSender, r io.Reader, chunkSize int) (int64, error) {
+	if chunkSize <= frameHeaderSize {
+		return 0, fmt.Errorf("chunk size %d leaves no room for framed data", chunkSize)
+	}
+	return SendFileWithFooter(framedChannel{channel}, r, chunkSize-frameHeaderSize)
+}
+
+// waitBuffered blocks until channel has at most limit bytes buffered
+func waitBuffered(channel Sender, drained <-chan struct{}, limit uint64) error {
+	for channel.BufferedAmount() > limit {
+		if channel.ReadyState() != webrtc.DataChannelStateOpen {
+			return ErrChannelClosed
+		}
+		log.Debugln("Waiting for buffered amount to drain:", channel.BufferedAmount())
+		select {
+		case <-drained:
+		case <-time.After(drainPoll):
+		}
+	}
+	return nil
+}
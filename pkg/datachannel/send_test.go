@@ -0,0 +1,251 @@
+/*
+ *   Copyright (c) 2021 Anton Brekhov
+ *   All rights reserved.
+ */
+package datachannel
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/abrekhov/hypertunnel/pkg/transfer"
+	"github.com/pion/webrtc/v3"
+)
+
+// fakeChannel drains its send buffer in the background like a slow receiver
+type fakeChannel struct {
+	mu          sync.Mutex
+	state       webrtc.DataChannelState
+	buffered    uint64
+	maxBuffered uint64
+	threshold   uint64
+	onLow       func()
+	received    bytes.Buffer
+	messages    int
+	texts       []string
+}
+
+func newFakeChannel() *fakeChannel {
+	return &fakeChannel{state: webrtc.DataChannelStateOpen}
+}
+
+func (c *fakeChannel) Send(data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.state != webrtc.DataChannelStateOpen {
+		return errors.New("closed")
+	}
+	c.received.Write(data)
+	c.messages++
+	c.buffered += uint64(len(data))
+	if c.buffered > c.maxBuffered {
+		c.maxBuffered = c.buffered
+	}
+	return nil
+}
+
+func (c *fakeChannel) SendText(text string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.state != webrtc.DataChannelStateOpen {
+		return errors.New("closed")
+	}
+	c.texts = append(c.texts, text)
+	c.buffered += uint64(len(text))
+	return nil
+}
+
+func (c *fakeChannel) ReadyState() webrtc.DataChannelState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state
+}
+
+func (c *fakeChannel) BufferedAmount() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.buffered
+}
+
+func (c *fakeChannel) SetBufferedAmountLowThreshold(th uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.threshold = th
+}
+
+func (c *fakeChannel) OnBufferedAmountLow(f func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onLow = f
+}
+
+// drain acknowledges n bytes every tick until stop is closed
+func (c *fakeChannel) drain(n uint64, tick time.Duration, stop <-chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		case <-time.After(tick):
+		}
+		c.mu.Lock()
+		before := c.buffered
+		if c.buffered > n {
+			c.buffered -= n
+		} else {
+			c.buffered = 0
+		}
+		crossed := before > c.threshold && c.buffered <= c.threshold
+		onLow := c.onLow
+		c.mu.Unlock()
+		if crossed && onLow != nil {
+			onLow()
+		}
+	}
+}
+
+func TestSendFileBackpressure(t *testing.T) {
+	data := make([]byte, 5*1024*1024+123)
+	rand.Read(data)
+
+	channel := newFakeChannel()
+	stop := make(chan struct{})
+	defer close(stop)
+	go channel.drain(256*1024, time.Millisecond, stop)
+
+	sent, err := SendFile(channel, bytes.NewReader(data), DefaultChunkSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sent != int64(len(data)) {
+		t.Errorf("sent = %d, want %d", sent, len(data))
+	}
+	if !bytes.Equal(channel.received.Bytes(), data) {
+		t.Error("received data differs")
+	}
+	if channel.maxBuffered > maxBufferedAmount+DefaultChunkSize {
+		t.Errorf("buffered up to %d bytes, limit is %d", channel.maxBuffered, maxBufferedAmount+DefaultChunkSize)
+	}
+	if channel.BufferedAmount() != 0 {
+		t.Error("SendFile returned before buffer drained")
+	}
+	wantMessages := (len(data) + DefaultChunkSize - 1) / DefaultChunkSize
+	if channel.messages != wantMessages {
+		t.Errorf("sent %d messages, want %d", channel.messages, wantMessages)
+	}
+}
+
+func TestSendFileChannelClosed(t *testing.T) {
+	channel := newFakeChannel()
+	// Nothing drains, then the peer goes away
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		channel.mu.Lock()
+		channel.state = webrtc.DataChannelStateClosed
+		channel.mu.Unlock()
+	}()
+
+	_, err := SendFile(channel, bytes.NewReader(make([]byte, 2*maxBufferedAmount)), DefaultChunkSize)
+	if !errors.Is(err, ErrChannelClosed) {
+		t.Errorf("err = %v, want ErrChannelClosed", err)
+	}
+}
+
+func TestSendFileWithFooter(t *testing.T) {
+	data := make([]byte, 200*1024+7)
+	rand.Read(data)
+
+	channel := newFakeChannel()
+	stop := make(chan struct{})
+	defer close(stop)
+	go channel.drain(256*1024, time.Millisecond, stop)
+
+	if _, err := SendFileWithFooter(channel, bytes.NewReader(data), DefaultChunkSize); err != nil {
+		t.Fatal(err)
+	}
+	if len(channel.texts) != 1 {
+		t.Fatalf("sent %d text messages, want footer only", len(channel.texts))
+	}
+	footer, err := transfer.ParseFooter(channel.texts[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := transfer.NewChecksumWriter(io.Discard)
+	received.Write(channel.received.Bytes())
+	if err := footer.Verify(received); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSendFileFramed(t *testing.T) {
+	data := make([]byte, 200*1024+7)
+	rand.Read(data)
+	copy(data, transfer.FooterPrefix)
+
+	channel := newFakeChannel()
+	stop := make(chan struct{})
+	defer close(stop)
+	go channel.drain(256*1024, time.Millisecond, stop)
+
+	if _, err := SendFileFramed(channel, bytes.NewReader(data), DefaultChunkSize); err != nil {
+		t.Fatal(err)
+	}
+	if len(channel.texts) != 0 {
+		t.Errorf("sent %d text messages, framed sender sends frames only", len(channel.texts))
+	}
+	// Frames are length prefixed, so the sent stream splits back into them
+	var out bytes.Buffer
+	r := newFileReceiver(&out, true)
+	stream := channel.received.Bytes()
+	for len(stream) > 0 {
+		size := frameHeaderSize + int(binary.BigEndian.Uint32(stream[1:frameHeaderSize]))
+		if size > DefaultChunkSize {
+			t.Fatalf("frame of %d bytes exceeds chunk size", size)
+		}
+		if err := r.handleMessage(webrtc.DataChannelMessage{Data: stream[:size]}); err != nil {
+			t.Fatal(err)
+		}
+		stream = stream[size:]
+	}
+	if !bytes.Equal(out.Bytes(), data) {
+		t.Error("received data differs")
+	}
+	if err := r.verify(); err != nil || r.footer == nil {
+		t.Errorf("footer %+v, verify: %v", r.footer, err)
+	}
+}
+
+func TestClampChunkSize(t *testing.T) {
+	tests := []struct {
+		chunkSize int
+		max       uint32
+		want      int
+		wantErr   bool
+	}{
+		{DefaultChunkSize, 0, DefaultChunkSize, false},
+		{DefaultChunkSize, 65536, DefaultChunkSize, false},
+		{DefaultChunkSize, DefaultChunkSize, DefaultChunkSize, false},
+		{1024, 16384, 1024, false},
+		{DefaultChunkSize, 16384, 16384, false},
+		{DefaultChunkSize, minChunkSize, minChunkSize, false},
+		{DefaultChunkSize, 512, 0, true},
+		{512, 512, 512, false},
+		{0, 0, 0, true},
+		{-1, 65536, 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ClampChunkSize(tt.chunkSize, webrtc.SCTPCapabilities{MaxMessageSize: tt.max})
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ClampChunkSize(%d, %d) err = %v, wantErr %v", tt.chunkSize, tt.max, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ClampChunkSize(%d, %d) = %d, want %d", tt.chunkSize, tt.max, got, tt.want)
+		}
+	}
+}
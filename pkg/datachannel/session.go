@@ -0,0 +1,413 @@
+/*
+ *   Copyright (c) 2021 Anton Brekhov
+ *   All rights reserved.
+ */
+package datachannel
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+	log "github.com/sirupsen/logrus"
+)
+
+// incomingChannels is how many data channels wait for Receive
+const incomingChannels = 8
+
+var (
+	// ErrConnect wraps failures of ICE, DTLS or SCTP startup, which are worth
+	// retrying with fresh signals
+	ErrConnect = errors.New("connection failed")
+	// ErrConnectionLost is returned when established connection fails or closes
+	ErrConnectionLost = errors.New("connection lost")
+	// ErrNoCandidates is returned when gathering found no usable candidates
+	ErrNoCandidates = errors.New("no local ICE candidates gathered, check network and candidate filters")
+	// ErrNotConnected is returned when sending before SetRemoteSignal succeeded
+	ErrNotConnected = errors.New("session is not connected")
+	// ErrNotAccepted is returned when receiver doesn't accept file within
+	// SessionConfig.AcceptTimeout
+	ErrNotAccepted = errors.New("receiver didn't accept the file")
+)
+
+// SessionConfig controls Session
+type SessionConfig struct {
+	// ChunkSize is size of sent messages, reduced to what the peer accepts
+	ChunkSize int
+	// SignalTTL rejects older remote signals, 0 accepts any age
+	SignalTTL time.Duration
+	// DropMDNS ignores remote .local candidates, for APIs with mDNS disabled
+	DropMDNS bool
+	// CandidateFilter picks gathered candidates put into the local signal,
+	// nil keeps all
+	CandidateFilter func(webrtc.ICECandidate) bool
+	// AcceptTimeout limits how long Send waits for the receiver to accept
+	// the file, e.g. while the user answers the prompt. 0 waits until the
+	// receiver declines or goes away.
+	AcceptTimeout time.Duration
+	// Transfer controls receiving files
+	Transfer Config
+}
+
+// DefaultSessionConfig returns configuration used when nothing is set
+func DefaultSessionConfig() SessionConfig {
+	return SessionConfig{
+		ChunkSize: DefaultChunkSize,
+		Transfer:  DefaultConfig(),
+	}
+}
+
+// Session is one side of a transfer: it gathers candidates, exchanges signals
+// with the peer, starts ICE, DTLS and SCTP transports and sends or receives
+// files over them. A failed session can't be restarted, create a new one.
+type Session struct {
+	cfg      SessionConfig
+	api      *webrtc.API
+	gatherer *webrtc.ICEGatherer
+	ice      *webrtc.ICETransport
+	dtls     *webrtc.DTLSTransport
+	sctp     *webrtc.SCTPTransport
+
+	local     *Signal
+	remote    Signal
+	agreement Agreement
+	incoming  chan *webrtc.DataChannel
+
+	mu        sync.Mutex
+	connected bool
+	lost      chan struct{}
+	lostErr   error
+	closeOnce sync.Once
+}
+
+// NewSession creates transports of api, candidates are gathered with
+// gatherOptions on first LocalSignal call
+func NewSession(api *webrtc.API, gatherOptions webrtc.ICEGatherOptions, cfg SessionConfig) (*Session, error) {
+	gatherer, err := api.NewICEGatherer(gatherOptions)
+	if err != nil {
+		return nil, err
+	}
+	ice := api.NewICETransport(gatherer)
+	dtls, err := api.NewDTLSTransport(ice, nil)
+	if err != nil {
+		gatherer.Close()
+		return nil, err
+	}
+	s := &Session{
+		cfg:      cfg,
+		api:      api,
+		gatherer: gatherer,
+		ice:      ice,
+		dtls:     dtls,
+		sctp:     api.NewSCTPTransport(dtls),
+		incoming: make(chan *webrtc.DataChannel, incomingChannels),
+		lost:     make(chan struct{}),
+	}
+	s.sctp.OnDataChannel(func(channel *webrtc.DataChannel) {
+		select {
+		case s.incoming <- channel:
+		default:
+			// Nobody receives, e.g. on the sending side. Pion waits for this
+			// handler before accepting more channels, so don't block it.
+			// Closing tells the peer to give up, it only works once open.
+			log.Warnf("Declining data channel %s, no file is expected\n", channel.Label())
+			channel.OnOpen(func() { channel.Close() })
+		}
+	})
+	s.ice.OnConnectionStateChange(s.connectionStateChanged)
+	// Relayed transfers are slower and use TURN bandwidth, tell the user once
+	var relayNotice sync.Once
+	s.ice.OnSelectedCandidatePairChange(func(pair *webrtc.ICECandidatePair) {
+		log.Debugf("Selected candidate pair: %s\n", pair)
+		if pairType := ClassifyPair(pair); pairType == PairRelayed || pairType == PairHalfRelayed {
+			relayNotice.Do(func() {
+				log.Infof("Connection is %s through TURN, check NAT/firewall settings for a direct path\n", pairType)
+			})
+		}
+	})
+	return s, nil
+}
+
+// LocalSignal gathers candidates once and returns encoded signal to hand to
+// the peer
+func (s *Session) LocalSignal() (string, error) {
+	if s.local == nil {
+		local, err := s.gather()
+		if err != nil {
+			return "", err
+		}
+		s.local = &local
+	}
+	return EncodeSignal(*s.local)
+}
+
+func (s *Session) gather() (Signal, error) {
+	gatherFinished := make(chan struct{})
+	s.gatherer.OnLocalCandidate(func(c *webrtc.ICECandidate) {
+		if c == nil {
+			close(gatherFinished)
+		}
+	})
+	if err := s.gatherer.Gather(); err != nil {
+		return Signal{}, err
+	}
+	<-gatherFinished
+
+	candidates, err := s.gatherer.GetLocalCandidates()
+	if err != nil {
+		return Signal{}, err
+	}
+	if s.cfg.CandidateFilter != nil {
+		candidates = FilterCandidates(candidates, s.cfg.CandidateFilter)
+	}
+	if len(candidates) == 0 {
+		return Signal{}, ErrNoCandidates
+	}
+	iceParams, err := s.gatherer.GetLocalParameters()
+	if err != nil {
+		return Signal{}, err
+	}
+	dtlsParams, err := s.dtls.GetLocalParameters()
+	if err != nil {
+		return Signal{}, err
+	}
+	signal := Signal{
+		ICECandidates:    candidates,
+		ICEParameters:    iceParams,
+		DTLSParameters:   dtlsParams,
+		SCTPCapabilities: s.sctp.GetCapabilities(),
+		Capabilities:     LocalCapabilities(),
+	}
+	return signal, signal.Stamp()
+}
+
+// SetRemoteSignal checks encoded signal of the peer and connects to it. ICE
+// role comes from both signals, so either side may call it first. Transport
+// failures are wrapped in ErrConnect.
+func (s *Session) SetRemoteSignal(encoded string) error {
+	if err := DecodeSignal(encoded, &s.remote); err != nil {
+		return err
+	}
+	if err := s.remote.Validate(); err != nil {
+		return err
+	}
+	if err := CheckSignalAge(s.remote, s.cfg.SignalTTL); err != nil {
+		return err
+	}
+	s.remote.ICECandidates = NormalizeCandidates(s.remote.ICECandidates)
+	if s.cfg.DropMDNS {
+		// .local hostnames can't be resolved with mDNS off
+		s.remote.ICECandidates = DropMDNSCandidates(s.remote.ICECandidates)
+	}
+	if _, err := s.LocalSignal(); err != nil {
+		return err
+	}
+	log.Infof("Signal fingerprints, compare with the other side: local %s, peer %s\n", SignalFingerprint(*s.local), SignalFingerprint(s.remote))
+	agreement, err := Negotiate(s.local.Capabilities, s.remote.Capabilities)
+	if err != nil {
+		return err
+	}
+	s.agreement = agreement
+	log.Debugf("Negotiated: %+v\n", agreement)
+
+	role, err := s.iceRole()
+	if err != nil {
+		return err
+	}
+	if err := s.ice.SetRemoteCandidates(s.remote.ICECandidates); err != nil {
+		return err
+	}
+	log.Debugln("Start ICE TR")
+	if err := s.ice.Start(s.gatherer, s.remote.ICEParameters, &role); err != nil {
+		return fmt.Errorf("%w: ICE: %v", ErrConnect, err)
+	}
+	log.Debugln("Start DTLS")
+	if err := s.dtls.Start(s.remote.DTLSParameters); err != nil {
+		return fmt.Errorf("%w: DTLS: %v", ErrConnect, err)
+	}
+	log.Debugln("Start SCTP")
+	if err := s.sctp.Start(s.remote.SCTPCapabilities); err != nil {
+		return fmt.Errorf("%w: SCTP: %v", ErrConnect, err)
+	}
+	s.mu.Lock()
+	s.connected = true
+	s.mu.Unlock()
+	return nil
+}
+
+// iceRole returns ICE role of the local side. It depends only on exchanged
+// signals, so peers get opposite roles whichever starts first.
+func (s *Session) iceRole() (webrtc.ICERole, error) {
+	role, err := DetermineICERoleWithDTLS(s.local.ICEParameters, s.local.DTLSParameters, s.remote.ICEParameters, s.remote.DTLSParameters)
+	if err != nil {
+		return role, err
+	}
+	log.Debugf("ICE role: %s\n", role)
+	return role, nil
+}
+
+// Agreement returns what peers agreed on in SetRemoteSignal
+func (s *Session) Agreement() Agreement {
+	return s.agreement
+}
+
+// connectionStateChanged logs ICE state transitions. Once connected, failed
+// or closed connection ends Send and Receive with ErrConnectionLost.
+// Disconnected is transient: ICE keeps checking and either recovers or fails.
+func (s *Session) connectionStateChanged(state webrtc.ICETransportState) {
+	log.Infof("Connection %s\n", state)
+	if state != webrtc.ICETransportStateFailed && state != webrtc.ICETransportStateClosed {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.connected || s.lostErr != nil {
+		return
+	}
+	s.lostErr = fmt.Errorf("%w: %s", ErrConnectionLost, state)
+	close(s.lost)
+}
+
+// Lost returns channel closed when connection fails or closes after
+// SetRemoteSignal succeeded, Err tells why
+func (s *Session) Lost() <-chan struct{} {
+	return s.lost
+}
+
+// Err returns why connection was lost, nil while it's alive
+func (s *Session) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lostErr
+}
+
+// SendFile sends file at path labelled with its base name
+func (s *Session) SendFile(path string) error {
+	fd, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	_, err = s.Send(filepath.Base(path), fd)
+	return err
+}
+
+// Send opens data channel labelled name, waits until the receiver accepts the
+// file and streams r with checksum footer. After everything is sent it waits
+// for the receiver to close the channel or go away, so the caller may exit.
+func (s *Session) Send(name string, r io.Reader) (int64, error) {
+	s.mu.Lock()
+	connected := s.connected
+	s.mu.Unlock()
+	if !connected {
+		return 0, ErrNotConnected
+	}
+	chunkSize, err := ClampChunkSize(s.cfg.ChunkSize, s.remote.SCTPCapabilities)
+	if err != nil {
+		return 0, err
+	}
+	var id uint16 = 1
+	channel, err := s.api.NewDataChannel(s.sctp, &webrtc.DataChannelParameters{
+		Label:   name,
+		ID:      &id,
+		Ordered: true,
+	})
+	if err != nil {
+		return 0, err
+	}
+	// Don't stream until the receiver accepted the file
+	ready := NewReadyGate()
+	channel.OnMessage(ready.HandleMessage)
+	closed := make(chan struct{})
+	channel.OnClose(func() {
+		close(closed)
+	})
+
+	log.Infoln("Waiting for receiver to accept the file...")
+	var timeout <-chan time.Time
+	if s.cfg.AcceptTimeout > 0 {
+		timeout = time.After(s.cfg.AcceptTimeout)
+	}
+	select {
+	case <-ready.Ready():
+	case <-timeout:
+		channel.Close()
+		return 0, fmt.Errorf("%w within %s", ErrNotAccepted, s.cfg.AcceptTimeout)
+	case <-closed:
+		return 0, ErrChannelClosed
+	case <-s.lost:
+		return 0, s.Err()
+	}
+
+	send := SendFileWithFooter
+	if s.agreement.Framing {
+		send = SendFileFramed
+	}
+	type result struct {
+		sent int64
+		err  error
+	}
+	// Buffered sends stall when the peer is gone, don't wait for them then
+	results := make(chan result, 1)
+	go func() {
+		sent, err := send(channel, r, chunkSize)
+		results <- result{sent, err}
+	}()
+	var res result
+	select {
+	case res = <-results:
+	case <-s.lost:
+		return 0, s.Err()
+	}
+	if res.err != nil {
+		return res.sent, res.err
+	}
+	channel.Close()
+	// Receiver saves the file once the channel closes, then leaves
+	select {
+	case <-closed:
+	case <-s.lost:
+		log.Debugln("Receiver disconnected")
+	}
+	return res.sent, nil
+}
+
+// Receive saves files sent by the peer into destDir, prompting as configured,
+// until one is received or transfer fails. Declined files and files beyond
+// Config.MaxConnections don't end it.
+func (s *Session) Receive(destDir string) error {
+	cfg := s.cfg.Transfer
+	cfg.Dir = destDir
+	cfg.Framed = s.agreement.Framing
+	results := make(chan error, incomingChannels)
+	for {
+		select {
+		case channel := <-s.incoming:
+			go func() {
+				results <- <-FileTransferHandler(channel, cfg)
+			}()
+		case err := <-results:
+			if errors.Is(err, ErrConnectionLimit) || errors.Is(err, ErrDeclined) {
+				// Keep waiting for the file we accept
+				continue
+			}
+			return err
+		case <-s.lost:
+			return s.Err()
+		}
+	}
+}
+
+// Close stops all transports
+func (s *Session) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		err = errors.Join(s.sctp.Stop(), s.dtls.Stop(), s.ice.Stop(), s.gatherer.Close())
+	})
+	return err
+}
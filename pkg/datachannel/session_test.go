@@ -0,0 +1,147 @@
+/*
+ *   Copyright (c) 2021 Anton Brekhov
+ *   All rights reserved.
+ */
+package datachannel
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/pion/webrtc/v3"
+)
+
+func newTestSession(t *testing.T) *Session {
+	t.Helper()
+	s, err := NewSession(webrtc.NewAPI(), webrtc.ICEGatherOptions{}, DefaultSessionConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestSessionSetRemoteSignalInvalid(t *testing.T) {
+	s := newTestSession(t)
+	if err := s.SetRemoteSignal("not a signal"); err == nil {
+		t.Error("expected error for garbage signal")
+	}
+	empty, err := EncodeSignal(Signal{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetRemoteSignal(empty); !errors.Is(err, ErrInvalidSignal) {
+		t.Errorf("err = %v, want ErrInvalidSignal", err)
+	}
+}
+
+func TestSessionSendNotConnected(t *testing.T) {
+	s := newTestSession(t)
+	if _, err := s.Send("early.bin", bytes.NewReader(nil)); !errors.Is(err, ErrNotConnected) {
+		t.Errorf("err = %v, want ErrNotConnected", err)
+	}
+}
+
+func TestSessionConnectionLost(t *testing.T) {
+	s := newTestSession(t)
+	// Failures while connecting are returned by SetRemoteSignal instead
+	s.connectionStateChanged(webrtc.ICETransportStateFailed)
+	select {
+	case <-s.Lost():
+		t.Fatal("lost before connected")
+	default:
+	}
+
+	s.connected = true
+	for _, state := range []webrtc.ICETransportState{
+		webrtc.ICETransportStateChecking,
+		webrtc.ICETransportStateConnected,
+		webrtc.ICETransportStateCompleted,
+	} {
+		s.connectionStateChanged(state)
+	}
+	if s.Err() != nil {
+		t.Fatalf("healthy states reported lost connection: %v", s.Err())
+	}
+	s.connectionStateChanged(webrtc.ICETransportStateFailed)
+	select {
+	case <-s.Lost():
+	default:
+		t.Fatal("lost channel not closed")
+	}
+	if !errors.Is(s.Err(), ErrConnectionLost) {
+		t.Errorf("err = %v, want ErrConnectionLost", s.Err())
+	}
+
+	closed := newTestSession(t)
+	closed.connected = true
+	closed.connectionStateChanged(webrtc.ICETransportStateClosed)
+	if !errors.Is(closed.Err(), ErrConnectionLost) {
+		t.Errorf("closed: err = %v, want ErrConnectionLost", closed.Err())
+	}
+}
+
+func TestSessionDisconnectedRecovers(t *testing.T) {
+	s := newTestSession(t)
+	s.connected = true
+	// A brief network hiccup, ICE reconnects on its own
+	s.connectionStateChanged(webrtc.ICETransportStateDisconnected)
+	s.connectionStateChanged(webrtc.ICETransportStateChecking)
+	s.connectionStateChanged(webrtc.ICETransportStateConnected)
+	select {
+	case <-s.Lost():
+		t.Fatalf("recovered connection reported lost: %v", s.Err())
+	default:
+	}
+	if s.Err() != nil {
+		t.Errorf("err = %v, want nil", s.Err())
+	}
+}
+
+func TestSessionICERoleSymmetric(t *testing.T) {
+	signal := func(ufrag, password, fingerprint string) Signal {
+		return Signal{
+			ICEParameters:  webrtc.ICEParameters{UsernameFragment: ufrag, Password: password},
+			DTLSParameters: webrtc.DTLSParameters{Fingerprints: []webrtc.DTLSFingerprint{{Algorithm: "sha-256", Value: fingerprint}}},
+		}
+	}
+	tests := []struct {
+		name string
+		a, b Signal
+	}{
+		{"different ufrags", signal("AbCd", "a", "AA"), signal("zYxW", "b", "AA")},
+		{"same ufrag", signal("same", "a", "AA"), signal("same", "b", "BB")},
+		{"same ICE parameters", signal("same", "pw", "AA"), signal("same", "pw", "BB")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := newTestSession(t), newTestSession(t)
+			a.local, a.remote = &tt.a, tt.b
+			b.local, b.remote = &tt.b, tt.a
+			roleA, err := a.iceRole()
+			if err != nil {
+				t.Fatal(err)
+			}
+			roleB, err := b.iceRole()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if roleA == roleB {
+				t.Errorf("both sessions got %s", roleA)
+			}
+		})
+	}
+}
+
+func TestSessionICERoleOwnSignal(t *testing.T) {
+	s := newTestSession(t)
+	own := Signal{
+		ICEParameters:  webrtc.ICEParameters{UsernameFragment: "self", Password: "pw"},
+		DTLSParameters: webrtc.DTLSParameters{Fingerprints: []webrtc.DTLSFingerprint{{Algorithm: "sha-256", Value: "AA"}}},
+	}
+	s.local, s.remote = &own, own
+	if _, err := s.iceRole(); !errors.Is(err, ErrSameSignal) {
+		t.Errorf("err = %v, want ErrSameSignal for own signal pasted back", err)
+	}
+}
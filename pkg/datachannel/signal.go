@@ -5,7 +5,26 @@
 
 package datachannel
 
-import "github.com/pion/webrtc/v3"
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// ErrSignalExpired is returned for signals older than allowed TTL
+	ErrSignalExpired = errors.New("signal expired, generate a fresh one")
+	// ErrInvalidSignal is returned by Signal.Validate for incomplete signals
+	ErrInvalidSignal = errors.New("invalid signal")
+)
+
+// signalNow returns current time, replaced in tests
+var signalNow = time.Now
 
 // Signal is used to exchange signaling info.
 // This is not part of the ORTC spec. You are free
@@ -15,4 +34,56 @@ type Signal struct {
 	ICEParameters    webrtc.ICEParameters    `json:"iceParameters"`
 	DTLSParameters   webrtc.DTLSParameters   `json:"dtlsParameters"`
 	SCTPCapabilities webrtc.SCTPCapabilities `json:"sctpCapabilities"`
+	// Capabilities are missing in signals of older versions
+	Capabilities *Capabilities `json:"capabilities,omitempty"`
+	// CreatedAt (unix seconds) and Nonce are set by Stamp, older versions
+	// don't send them
+	CreatedAt int64  `json:"createdAt,omitempty"`
+	Nonce     string `json:"nonce,omitempty"`
+}
+
+// Stamp marks signal with creation time and random nonce
+func (s *Signal) Stamp() error {
+	nonce := make([]byte, 8)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	s.CreatedAt = signalNow().Unix()
+	s.Nonce = hex.EncodeToString(nonce)
+	return nil
+}
+
+// Validate checks that s has everything transports need to start, so a
+// truncated or mangled signal fails with a clear error instead of a transport one
+func (s Signal) Validate() error {
+	if len(s.ICECandidates) == 0 {
+		return fmt.Errorf("%w: no ICE candidates, the peer may be offline or its signal was cut", ErrInvalidSignal)
+	}
+	if s.ICEParameters.UsernameFragment == "" {
+		return fmt.Errorf("%w: empty ICE username fragment", ErrInvalidSignal)
+	}
+	if s.ICEParameters.Password == "" {
+		return fmt.Errorf("%w: empty ICE password", ErrInvalidSignal)
+	}
+	if len(s.DTLSParameters.Fingerprints) == 0 {
+		return fmt.Errorf("%w: no DTLS fingerprints", ErrInvalidSignal)
+	}
+	return nil
+}
+
+// CheckSignalAge returns ErrSignalExpired when s was created more than ttl
+// ago. Zero ttl and signals without timestamp are always accepted.
+func CheckSignalAge(s Signal, ttl time.Duration) error {
+	if ttl <= 0 {
+		return nil
+	}
+	if s.CreatedAt == 0 {
+		log.Debugln("Signal has no timestamp, can't check its age")
+		return nil
+	}
+	age := signalNow().Sub(time.Unix(s.CreatedAt, 0))
+	if age > ttl {
+		return fmt.Errorf("%w (created %s ago, ttl %s)", ErrSignalExpired, age.Truncate(time.Second), ttl)
+	}
+	return nil
 }
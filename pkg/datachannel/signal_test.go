@@ -0,0 +1,105 @@
+/*
+ *   Copyright (c) 2021 Anton Brekhov
+ *   All rights reserved.
+ */
+package datachannel
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+func TestSignalStamp(t *testing.T) {
+	var a, b Signal
+	if err := a.Stamp(); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Stamp(); err != nil {
+		t.Fatal(err)
+	}
+	if a.CreatedAt == 0 || a.Nonce == "" {
+		t.Fatalf("signal not stamped: %+v", a)
+	}
+	if a.Nonce == b.Nonce {
+		t.Error("nonces repeat")
+	}
+
+	encoded, err := EncodeSignal(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Signal
+	if err := DecodeSignal(encoded, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.CreatedAt != a.CreatedAt || got.Nonce != a.Nonce {
+		t.Errorf("stamp lost: %+v", got)
+	}
+}
+
+func TestCheckSignalAge(t *testing.T) {
+	created := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	defer func(f func() time.Time) { signalNow = f }(signalNow)
+
+	tests := []struct {
+		name      string
+		createdAt int64
+		elapsed   time.Duration
+		ttl       time.Duration
+		wantErr   bool
+	}{
+		{"fresh", created.Unix(), time.Minute, 5 * time.Minute, false},
+		{"expired", created.Unix(), 6 * time.Minute, 5 * time.Minute, true},
+		{"no ttl", created.Unix(), 24 * time.Hour, 0, false},
+		{"no timestamp", 0, 0, 5 * time.Minute, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signalNow = func() time.Time { return created.Add(tt.elapsed) }
+			err := CheckSignalAge(Signal{CreatedAt: tt.createdAt}, tt.ttl)
+			if tt.wantErr != errors.Is(err, ErrSignalExpired) {
+				t.Errorf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSignalValidate(t *testing.T) {
+	valid := func() Signal {
+		return Signal{
+			ICECandidates:  []webrtc.ICECandidate{{Address: "192.0.2.1", Port: 5000, Protocol: webrtc.ICEProtocolUDP, Typ: webrtc.ICECandidateTypeHost}},
+			ICEParameters:  webrtc.ICEParameters{UsernameFragment: "ufrag", Password: "password"},
+			DTLSParameters: webrtc.DTLSParameters{Fingerprints: []webrtc.DTLSFingerprint{{Algorithm: "sha-256", Value: "AA:BB"}}},
+		}
+	}
+	tests := []struct {
+		name   string
+		modify func(s *Signal)
+		want   string
+	}{
+		{"no candidates", func(s *Signal) { s.ICECandidates = nil }, "no ICE candidates"},
+		{"no ufrag", func(s *Signal) { s.ICEParameters.UsernameFragment = "" }, "empty ICE username fragment"},
+		{"no password", func(s *Signal) { s.ICEParameters.Password = "" }, "empty ICE password"},
+		{"no fingerprints", func(s *Signal) { s.DTLSParameters.Fingerprints = nil }, "no DTLS fingerprints"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := valid()
+			tt.modify(&s)
+			err := s.Validate()
+			if !errors.Is(err, ErrInvalidSignal) {
+				t.Fatalf("err = %v, want ErrInvalidSignal", err)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %q, want it to mention %q", err, tt.want)
+			}
+		})
+	}
+	if err := valid().Validate(); err != nil {
+		t.Errorf("valid signal: %v", err)
+	}
+}
@@ -0,0 +1,138 @@
+/*
+ *   Copyright (c) 2021 Anton Brekhov
+ *   All rights reserved.
+ */
+package datachannel
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// partialSuffix ends names of files being received
+const partialSuffix = ".partial"
+
+// Sink creates destinations for received files
+type Sink interface {
+	Create(name string) (io.WriteCloser, error)
+}
+
+// Committer is implemented by writers of Sink that keep received data aside
+// until the transfer succeeds. After Close, Commit publishes the data when the
+// file is complete and verified, Abort discards it otherwise.
+type Committer interface {
+	Commit() error
+	Abort() error
+}
+
+// fileSink saves received files in dir, the working directory when empty.
+// Data goes to a temporary file next to the destination, which is renamed
+// only when the transfer succeeds. It's used when Config.Sink is nil.
+type fileSink struct {
+	dir string
+	// overwrite replaces existing file, otherwise Commit fails when it exists
+	overwrite bool
+	fsync     bool
+}
+
+func (s fileSink) Create(name string) (io.WriteCloser, error) {
+	dest := filepath.Join(s.dir, name)
+	if !s.overwrite {
+		if _, err := os.Lstat(dest); err == nil {
+			return nil, fmt.Errorf("%s: %w", dest, os.ErrExist)
+		}
+	}
+	fd, err := os.CreateTemp(s.dir, name+".*"+partialSuffix)
+	if err != nil {
+		return nil, err
+	}
+	// CreateTemp makes the file private, received files are regular ones
+	if err := fd.Chmod(0644); err != nil {
+		fd.Close()
+		os.Remove(fd.Name())
+		return nil, err
+	}
+	return &savedFile{File: fd, dest: dest, overwrite: s.overwrite, fsync: s.fsync}, nil
+}
+
+// savedFile is a temporary file renamed to dest on Commit
+type savedFile struct {
+	*os.File
+	dest      string
+	overwrite bool
+	fsync     bool
+}
+
+// Close closes the temporary file, flushing it to disk first with fsync
+func (f *savedFile) Close() error {
+	if f.fsync {
+		if err := fileSyncer(f.File); err != nil {
+			f.File.Close()
+			return err
+		}
+	}
+	return f.File.Close()
+}
+
+// Commit renames the temporary file to its destination. With fsync the
+// directory is flushed too, so a crash right after completion doesn't lose it.
+func (f *savedFile) Commit() error {
+	if !f.overwrite {
+		// Rename replaces silently, don't clobber a file created meanwhile
+		if _, err := os.Lstat(f.dest); err == nil {
+			return fmt.Errorf("%s: %w", f.dest, os.ErrExist)
+		}
+	}
+	if err := os.Rename(f.Name(), f.dest); err != nil {
+		return err
+	}
+	if !f.fsync {
+		return nil
+	}
+	return dirSyncer(filepath.Dir(f.dest))
+}
+
+// Abort removes the temporary file
+func (f *savedFile) Abort() error {
+	f.File.Close()
+	return os.Remove(f.Name())
+}
+
+// settle commits w when transfer ended without err and aborts it otherwise.
+// Writers that aren't Committers have nothing to settle.
+func settle(w io.WriteCloser, err error) error {
+	c, ok := w.(Committer)
+	if !ok {
+		return err
+	}
+	if err == nil {
+		if err = c.Commit(); err == nil {
+			return nil
+		}
+		err = fmt.Errorf("failed to save file: %w", err)
+	}
+	if aerr := c.Abort(); aerr != nil {
+		log.Warnln("Failed to remove partial file:", aerr)
+	}
+	return err
+}
+
+// WriterSink writes every received file to W, e.g. os.Stdout
+type WriterSink struct {
+	W io.Writer
+}
+
+// Create returns W, closing it does nothing
+func (s WriterSink) Create(name string) (io.WriteCloser, error) {
+	return nopWriteCloser{s.W}, nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
@@ -0,0 +1,12 @@
+//go:build windows
+
+/*
+ *   Copyright (c) 2021 Anton Brekhov
+ *   All rights reserved.
+ */
+package datachannel
+
+// syncDir is a no-op, directories can't be synced on Windows
+func syncDir(dir string) error {
+	return nil
+}
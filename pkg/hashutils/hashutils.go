@@ -5,12 +5,47 @@
 package hashutils
 
 import (
+	"crypto/rand"
 	"crypto/sha256"
+	"errors"
+	"io"
 
 	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/argon2"
 )
 
-// FromKeyToAESKey any pwd to 16byte string as hash
+// Argon2id parameters (RFC 9106 second recommended option)
+const (
+	SaltSize    = 16
+	KeySize     = 32
+	argonTime   = 3
+	argonMemory = 64 * 1024
+	argonLanes  = 4
+)
+
+// ErrShortSalt is returned when salt is shorter than SaltSize
+var ErrShortSalt = errors.New("salt is too short")
+
+// GenerateSalt returns SaltSize random bytes
+func GenerateSalt() ([]byte, error) {
+	salt := make([]byte, SaltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+	return salt, nil
+}
+
+// DeriveKey stretches passphrase with salt to 32 byte key using Argon2id
+func DeriveKey(passphrase string, salt []byte) ([]byte, error) {
+	if len(salt) < SaltSize {
+		return nil, ErrShortSalt
+	}
+	return argon2.IDKey([]byte(passphrase), salt, argonTime, argonMemory, argonLanes, KeySize), nil
+}
+
+// FromKeyToAESKey any pwd to 32byte key as SHA-256 hash
+//
+// Deprecated: unsalted and fast to brute-force, use DeriveKey instead.
 func FromKeyToAESKey(userkey string) []byte {
 	h := sha256.New()
 	wrtn, err := h.Write([]byte(userkey))
@@ -0,0 +1,61 @@
+/*
+ *   Copyright (c) 2021 Anton Brekhov anton.brekhov@rsc-tech.ru
+ *   All rights reserved.
+ */
+package hashutils
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+func TestDeriveKeyKnownAnswer(t *testing.T) {
+	tests := []struct {
+		passphrase string
+		salt       []byte
+		want       string
+	}{
+		{"password", bytes.Repeat([]byte{1}, 16), "f770ad3c6d81a6a2d10e6548623dc5f9dbd6124d97aea548135c56e9fdb203e1"},
+		{"hypertunnel", []byte("0123456789abcdef"), "0df759fa4b429bf7ee2ce122825847bbbe7782108f6b91a508f6ab0061ec8fc9"},
+	}
+	for _, tt := range tests {
+		key, err := DeriveKey(tt.passphrase, tt.salt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := hex.EncodeToString(key); got != tt.want {
+			t.Errorf("DeriveKey(%q) = %s, want %s", tt.passphrase, got, tt.want)
+		}
+	}
+}
+
+func TestDeriveKeyDifferentSalts(t *testing.T) {
+	salt1, err := GenerateSalt()
+	if err != nil {
+		t.Fatal(err)
+	}
+	salt2, err := GenerateSalt()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(salt1, salt2) {
+		t.Fatal("GenerateSalt returned the same salt twice")
+	}
+
+	key1, _ := DeriveKey("passphrase", salt1)
+	key2, _ := DeriveKey("passphrase", salt2)
+	if len(key1) != KeySize {
+		t.Errorf("key length = %d, want %d", len(key1), KeySize)
+	}
+	if bytes.Equal(key1, key2) {
+		t.Error("different salts produced the same key")
+	}
+}
+
+func TestDeriveKeyShortSalt(t *testing.T) {
+	if _, err := DeriveKey("passphrase", []byte("short")); !errors.Is(err, ErrShortSalt) {
+		t.Errorf("err = %v, want ErrShortSalt", err)
+	}
+}
@@ -0,0 +1,139 @@
+/*
+ *   Copyright (c) 2021 Anton Brekhov
+ *   All rights reserved.
+ */
+
+// Package rendezvous exchanges connection signals through an HTTP relay, so
+// peers agreeing on a code don't need to copy signals by hand
+package rendezvous
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultPollInterval is how often Fetch asks relay for the peer signal
+const DefaultPollInterval = time.Second
+
+// ErrTimeout is returned when peer signal doesn't appear in time
+var ErrTimeout = errors.New("timed out waiting for peer signal")
+
+// message is the body of publish request
+type message struct {
+	Peer   string `json:"peer"`
+	Signal string `json:"signal"`
+}
+
+// Client publishes own signal and fetches signal of the other peer. Each
+// client has random peer ID so it never fetches its own signal back.
+type Client struct {
+	BaseURL      string
+	HTTP         *http.Client
+	PollInterval time.Duration
+	peer         string
+}
+
+// NewClient returns client of relay at baseURL
+func NewClient(baseURL string) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported relay url scheme %q, use http or https", u.Scheme)
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	return &Client{
+		BaseURL:      strings.TrimSuffix(baseURL, "/"),
+		HTTP:         http.DefaultClient,
+		PollInterval: DefaultPollInterval,
+		peer:         hex.EncodeToString(id),
+	}, nil
+}
+
+func (c *Client) signalURL(code string) string {
+	return c.BaseURL + "/signals/" + url.PathEscape(code)
+}
+
+// Publish stores signal on relay under code
+func (c *Client) Publish(ctx context.Context, code, signal string) error {
+	body, err := json.Marshal(message{Peer: c.peer, Signal: signal})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.signalURL(code), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return responseError(resp)
+	}
+	return nil
+}
+
+// Fetch polls relay until the other peer publishes its signal under code or
+// ctx is done
+func (c *Client) Fetch(ctx context.Context, code string) (string, error) {
+	for {
+		signal, err := c.fetchOnce(ctx, code)
+		if err != nil || signal != "" {
+			return signal, err
+		}
+		select {
+		case <-ctx.Done():
+			return "", ErrTimeout
+		case <-time.After(c.PollInterval):
+		}
+	}
+}
+
+// fetchOnce returns peer signal or empty string when it's not there yet
+func (c *Client) fetchOnce(ctx context.Context, code string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.signalURL(code)+"?peer="+url.QueryEscape(c.peer), nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", ErrTimeout
+		}
+		return "", err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		var msg message
+		if err := json.NewDecoder(resp.Body).Decode(&msg); err != nil {
+			return "", err
+		}
+		return msg.Signal, nil
+	case http.StatusNotFound:
+		return "", nil
+	}
+	return "", responseError(resp)
+}
+
+func responseError(resp *http.Response) error {
+	text, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("relay: %s: %s", resp.Status, strings.TrimSpace(string(text)))
+}
@@ -0,0 +1,102 @@
+/*
+ *   Copyright (c) 2021 Anton Brekhov
+ *   All rights reserved.
+ */
+package rendezvous
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newTestClient(t *testing.T, url string) *Client {
+	t.Helper()
+	c, err := NewClient(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.PollInterval = 10 * time.Millisecond
+	return c
+}
+
+func TestPublishFetch(t *testing.T) {
+	server := httptest.NewServer(NewServer(DefaultTTL))
+	defer server.Close()
+	alice, bob := newTestClient(t, server.URL), newTestClient(t, server.URL)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := alice.Publish(ctx, "abc123", "alice-signal"); err != nil {
+		t.Fatal(err)
+	}
+	// Bob publishes a bit later, Alice must wait for him
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		bob.Publish(ctx, "abc123", "bob-signal")
+	}()
+	got, err := alice.Fetch(ctx, "abc123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "bob-signal" {
+		t.Errorf("alice fetched %q, want bob-signal", got)
+	}
+	got, err = bob.Fetch(ctx, "abc123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "alice-signal" {
+		t.Errorf("bob fetched %q, want alice-signal", got)
+	}
+
+	// The code is taken by two peers now
+	if err := newTestClient(t, server.URL).Publish(ctx, "abc123", "mallory"); err == nil {
+		t.Error("third peer published under used code")
+	}
+}
+
+func TestFetchTimeout(t *testing.T) {
+	server := httptest.NewServer(NewServer(DefaultTTL))
+	defer server.Close()
+	alice := newTestClient(t, server.URL)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	alice.Publish(ctx, "lonely", "alice-signal")
+	if _, err := alice.Fetch(ctx, "lonely"); !errors.Is(err, ErrTimeout) {
+		t.Errorf("err = %v, want ErrTimeout", err)
+	}
+}
+
+func TestServerExpiresSignals(t *testing.T) {
+	relay := NewServer(time.Minute)
+	now := time.Now()
+	relay.now = func() time.Time { return now }
+	server := httptest.NewServer(relay)
+	defer server.Close()
+	alice, bob := newTestClient(t, server.URL), newTestClient(t, server.URL)
+	ctx := context.Background()
+
+	if err := alice.Publish(ctx, "old", "alice-signal"); err != nil {
+		t.Fatal(err)
+	}
+	relay.mu.Lock()
+	now = now.Add(2 * time.Minute)
+	relay.mu.Unlock()
+	signal, err := bob.fetchOnce(ctx, "old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signal != "" {
+		t.Errorf("fetched expired signal %q", signal)
+	}
+}
+
+func TestNewClientInvalidURL(t *testing.T) {
+	if _, err := NewClient("ftp://relay.example.com"); err == nil {
+		t.Error("expected error for ftp relay")
+	}
+}
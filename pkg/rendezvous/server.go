@@ -0,0 +1,121 @@
+/*
+ *   Copyright (c) 2021 Anton Brekhov
+ *   All rights reserved.
+ */
+package rendezvous
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultTTL is how long relay keeps published signals
+	DefaultTTL = 10 * time.Minute
+	// maxSignalSize bounds publish request body
+	maxSignalSize = 64 * 1024
+	// peersPerCode is how many peers may publish under one code
+	peersPerCode = 2
+)
+
+type entry struct {
+	signal  string
+	expires time.Time
+}
+
+// Server is reference relay keeping signals in memory for TTL
+type Server struct {
+	mu    sync.Mutex
+	ttl   time.Duration
+	codes map[string]map[string]entry
+	now   func() time.Time
+}
+
+// NewServer returns relay keeping signals for ttl
+func NewServer(ttl time.Duration) *Server {
+	return &Server{
+		ttl:   ttl,
+		codes: make(map[string]map[string]entry),
+		now:   time.Now,
+	}
+}
+
+// ServeHTTP handles POST and GET of /signals/{code}
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	code := strings.TrimPrefix(r.URL.Path, "/signals/")
+	if code == r.URL.Path || code == "" || strings.Contains(code, "/") {
+		http.NotFound(w, r)
+		return
+	}
+	switch r.Method {
+	case http.MethodPost:
+		s.publish(w, r, code)
+	case http.MethodGet:
+		s.fetch(w, r, code)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) publish(w http.ResponseWriter, r *http.Request, code string) {
+	var msg message
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxSignalSize)).Decode(&msg); err != nil || msg.Peer == "" || msg.Signal == "" {
+		http.Error(w, "invalid signal", http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expire()
+	peers := s.codes[code]
+	if peers == nil {
+		peers = make(map[string]entry)
+		s.codes[code] = peers
+	}
+	if _, ok := peers[msg.Peer]; !ok && len(peers) >= peersPerCode {
+		http.Error(w, "code is already used by two peers", http.StatusConflict)
+		return
+	}
+	peers[msg.Peer] = entry{signal: msg.Signal, expires: s.now().Add(s.ttl)}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// fetch returns signal of any peer except the asking one
+func (s *Server) fetch(w http.ResponseWriter, r *http.Request, code string) {
+	self := r.URL.Query().Get("peer")
+	s.mu.Lock()
+	s.expire()
+	var found *message
+	for peer, e := range s.codes[code] {
+		if peer != self {
+			found = &message{Peer: peer, Signal: e.signal}
+			break
+		}
+	}
+	s.mu.Unlock()
+	if found == nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(found)
+}
+
+// expire drops signals older than TTL, s.mu must be held
+func (s *Server) expire() {
+	now := s.now()
+	for code, peers := range s.codes {
+		for peer, e := range peers {
+			if now.After(e.expires) {
+				delete(peers, peer)
+			}
+		}
+		if len(peers) == 0 {
+			delete(s.codes, code)
+		}
+	}
+}
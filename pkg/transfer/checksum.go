@@ -0,0 +1,115 @@
+/*
+ *   Copyright (c) 2021 Anton Brekhov
+ *   All rights reserved.
+ */
+package transfer
+
+import (
+	"crypto/sha256"
+	"encoding"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"os"
+)
+
+// ErrInvalidChecksumState is returned when a marshaled hash state can't be restored
+var ErrInvalidChecksumState = errors.New("invalid checksum state")
+
+// checksumChunkSize is how much data is hashed between progress callbacks.
+const checksumChunkSize = 1 << 20
+
+// CalculateFileChecksum returns SHA-256 of the file at path
+func CalculateFileChecksum(path string) ([]byte, error) {
+	return CalculateFileChecksumProgress(path, nil)
+}
+
+// CalculateFileChecksumProgress returns SHA-256 of the file at path and
+// reports the number of bytes hashed so far after every chunk. cb may be nil.
+func CalculateFileChecksumProgress(path string, cb func(bytesHashed int64)) ([]byte, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	h := sha256.New()
+	var hashed int64
+	for {
+		n, err := io.CopyN(h, fd, checksumChunkSize)
+		hashed += n
+		if n > 0 && cb != nil {
+			cb(hashed)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return h.Sum(nil), nil
+}
+
+// ChecksumWriter passes writes through to the underlying writer and
+// calculates SHA-256 of everything written.
+type ChecksumWriter struct {
+	w            io.Writer
+	hash         hash.Hash
+	bytesWritten int64
+}
+
+// NewChecksumWriter wraps w with SHA-256 calculation
+func NewChecksumWriter(w io.Writer) *ChecksumWriter {
+	return &ChecksumWriter{w: w, hash: sha256.New()}
+}
+
+// NewChecksumWriterFromState wraps w and restores the digest-in-progress and
+// byte count saved by MarshalState, so hashing continues where it stopped.
+func NewChecksumWriterFromState(w io.Writer, state []byte) (*ChecksumWriter, error) {
+	if len(state) < 8 {
+		return nil, ErrInvalidChecksumState
+	}
+	cw := NewChecksumWriter(w)
+	cw.bytesWritten = int64(binary.BigEndian.Uint64(state[:8]))
+	if err := cw.hash.(encoding.BinaryUnmarshaler).UnmarshalBinary(state[8:]); err != nil {
+		return nil, errors.Join(ErrInvalidChecksumState, err)
+	}
+	return cw, nil
+}
+
+// Write writes p to the underlying writer and hashes the written part
+func (cw *ChecksumWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.hash.Write(p[:n])
+	cw.bytesWritten += int64(n)
+	return n, err
+}
+
+// BytesWritten returns number of bytes hashed so far
+func (cw *ChecksumWriter) BytesWritten() int64 {
+	return cw.bytesWritten
+}
+
+// Sum returns SHA-256 of the data written so far
+func (cw *ChecksumWriter) Sum() []byte {
+	return cw.hash.Sum(nil)
+}
+
+// SumHex returns hex encoded SHA-256 of the data written so far
+func (cw *ChecksumWriter) SumHex() string {
+	return hex.EncodeToString(cw.Sum())
+}
+
+// MarshalState serializes byte count and intermediate hash state
+func (cw *ChecksumWriter) MarshalState() ([]byte, error) {
+	hashState, err := cw.hash.(encoding.BinaryMarshaler).MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	state := make([]byte, 8, 8+len(hashState))
+	binary.BigEndian.PutUint64(state, uint64(cw.bytesWritten))
+	return append(state, hashState...), nil
+}
@@ -0,0 +1,107 @@
+/*
+ *   Copyright (c) 2021 Anton Brekhov
+ *   All rights reserved.
+ */
+package transfer
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCalculateFileChecksumProgress(t *testing.T) {
+	data := bytes.Repeat([]byte("hypertunnel"), 250000) // ~2.6MB, three chunks
+	path := filepath.Join(t.TempDir(), "file.bin")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var calls int
+	var last int64
+	sum, err := CalculateFileChecksumProgress(path, func(bytesHashed int64) {
+		calls++
+		if bytesHashed <= last {
+			t.Errorf("progress went backwards: %d after %d", bytesHashed, last)
+		}
+		last = bytesHashed
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last != int64(len(data)) {
+		t.Errorf("final progress = %d, want %d", last, len(data))
+	}
+	if calls != 3 {
+		t.Errorf("callback called %d times, want 3", calls)
+	}
+	want := sha256.Sum256(data)
+	if !bytes.Equal(sum, want[:]) {
+		t.Errorf("checksum = %x, want %x", sum, want)
+	}
+}
+
+func TestCalculateFileChecksumEmpty(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "empty")
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	sum, err := CalculateFileChecksum(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := sha256.Sum256(nil)
+	if !bytes.Equal(sum, want[:]) {
+		t.Errorf("checksum = %x, want %x", sum, want)
+	}
+}
+
+func TestChecksumWriterResumeFromState(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789abcdef"), 10000)
+	half := len(data) / 2
+
+	var out bytes.Buffer
+	first := NewChecksumWriter(&out)
+	if _, err := first.Write(data[:half]); err != nil {
+		t.Fatal(err)
+	}
+	state, err := first.MarshalState()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resumed, err := NewChecksumWriterFromState(&out, state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resumed.BytesWritten() != int64(half) {
+		t.Errorf("BytesWritten = %d, want %d", resumed.BytesWritten(), half)
+	}
+	if _, err := resumed.Write(data[half:]); err != nil {
+		t.Fatal(err)
+	}
+
+	whole := NewChecksumWriter(io.Discard)
+	whole.Write(data)
+	if resumed.SumHex() != whole.SumHex() {
+		t.Errorf("SumHex = %s, want %s", resumed.SumHex(), whole.SumHex())
+	}
+	if resumed.BytesWritten() != int64(len(data)) {
+		t.Errorf("BytesWritten = %d, want %d", resumed.BytesWritten(), len(data))
+	}
+	if !bytes.Equal(out.Bytes(), data) {
+		t.Error("underlying writer did not receive all data")
+	}
+}
+
+func TestNewChecksumWriterFromInvalidState(t *testing.T) {
+	for _, state := range [][]byte{nil, []byte("short"), []byte("0123456789garbage")} {
+		if _, err := NewChecksumWriterFromState(io.Discard, state); !errors.Is(err, ErrInvalidChecksumState) {
+			t.Errorf("state %q: err = %v, want ErrInvalidChecksumState", state, err)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+/*
+ *   Copyright (c) 2021 Anton Brekhov
+ *   All rights reserved.
+ */
+package transfer
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// CollisionStrategy names how a free file name is made when one is taken
+type CollisionStrategy string
+
+const (
+	// CollisionNumber makes "name (1).ext"
+	CollisionNumber CollisionStrategy = "number"
+	// CollisionDot makes "name.1.ext"
+	CollisionDot CollisionStrategy = "dot"
+	// CollisionDate makes "name-20060102.ext", then "name-20060102-1.ext"
+	CollisionDate CollisionStrategy = "date"
+)
+
+// maxCollisionTries bounds the search for a free name
+const maxCollisionTries = 10000
+
+// ErrNoAvailableName is returned when every candidate name is taken
+var ErrNoAvailableName = errors.New("no available file name")
+
+// now is replaced in tests
+var now = time.Now
+
+// ParseCollisionStrategy validates strategy name given by user
+func ParseCollisionStrategy(s string) (CollisionStrategy, error) {
+	switch strategy := CollisionStrategy(strings.ToLower(strings.TrimSpace(s))); strategy {
+	case CollisionNumber, CollisionDot, CollisionDate:
+		return strategy, nil
+	}
+	return "", fmt.Errorf("unknown collision format %q, use %s, %s or %s", s, CollisionNumber, CollisionDot, CollisionDate)
+}
+
+// NextAvailableName returns name if it's free in dir, otherwise the first free
+// name made by strategy. Result is a name in dir, not a path.
+func NextAvailableName(dir, name string, strategy CollisionStrategy) (string, error) {
+	free, err := isFree(dir, name)
+	if err != nil || free {
+		return name, err
+	}
+
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	if stem == "" {
+		// Dotfile like ".bashrc" has no extension
+		stem, ext = name, ""
+	}
+	date := now().Format("20060102")
+
+	for i := 1; i <= maxCollisionTries; i++ {
+		var candidate string
+		switch strategy {
+		case CollisionNumber:
+			candidate = fmt.Sprintf("%s (%d)%s", stem, i, ext)
+		case CollisionDot:
+			candidate = fmt.Sprintf("%s.%d%s", stem, i, ext)
+		case CollisionDate:
+			if i == 1 {
+				candidate = fmt.Sprintf("%s-%s%s", stem, date, ext)
+			} else {
+				candidate = fmt.Sprintf("%s-%s-%d%s", stem, date, i-1, ext)
+			}
+		default:
+			return "", fmt.Errorf("unknown collision format %q", strategy)
+		}
+		free, err := isFree(dir, candidate)
+		if err != nil {
+			return "", err
+		}
+		if free {
+			return candidate, nil
+		}
+	}
+	return "", ErrNoAvailableName
+}
+
+func isFree(dir, name string) (bool, error) {
+	_, err := os.Lstat(filepath.Join(dir, name))
+	if os.IsNotExist(err) {
+		return true, nil
+	}
+	return false, err
+}
@@ -0,0 +1,70 @@
+/*
+ *   Copyright (c) 2021 Anton Brekhov
+ *   All rights reserved.
+ */
+package transfer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNextAvailableName(t *testing.T) {
+	now = func() time.Time { return time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC) }
+	defer func() { now = time.Now }()
+
+	tests := []struct {
+		strategy CollisionStrategy
+		existing []string
+		want     string
+	}{
+		{CollisionNumber, nil, "report.txt"},
+		{CollisionNumber, []string{"report.txt"}, "report (1).txt"},
+		{CollisionNumber, []string{"report.txt", "report (1).txt", "report (2).txt"}, "report (3).txt"},
+		{CollisionDot, []string{"report.txt"}, "report.1.txt"},
+		{CollisionDot, []string{"report.txt", "report.1.txt", "report.2.txt"}, "report.3.txt"},
+		{CollisionDate, []string{"report.txt"}, "report-20240101.txt"},
+		{CollisionDate, []string{"report.txt", "report-20240101.txt", "report-20240101-1.txt"}, "report-20240101-2.txt"},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		for _, name := range tt.existing {
+			if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		got, err := NextAvailableName(dir, "report.txt", tt.strategy)
+		if err != nil {
+			t.Errorf("%s with %v: %v", tt.strategy, tt.existing, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s with %v = %q, want %q", tt.strategy, tt.existing, got, tt.want)
+		}
+	}
+}
+
+func TestNextAvailableNameDotfile(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, ".bashrc"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := NextAvailableName(dir, ".bashrc", CollisionNumber)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != ".bashrc (1)" {
+		t.Errorf("got %q, want %q", got, ".bashrc (1)")
+	}
+}
+
+func TestParseCollisionStrategy(t *testing.T) {
+	if s, err := ParseCollisionStrategy("Dot"); err != nil || s != CollisionDot {
+		t.Errorf("ParseCollisionStrategy(Dot) = %q, %v", s, err)
+	}
+	if _, err := ParseCollisionStrategy("random"); err == nil {
+		t.Error("expected error for unknown strategy")
+	}
+}
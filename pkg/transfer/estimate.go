@@ -0,0 +1,28 @@
+/*
+ *   Copyright (c) 2021 Anton Brekhov
+ *   All rights reserved.
+ */
+package transfer
+
+import (
+	"math"
+	"time"
+)
+
+// EstimateDuration returns how long transferring size bytes takes at
+// bytesPerSecond, rounded to a second. It returns 0 when nothing is left to
+// transfer or the speed is unknown (zero or negative).
+func EstimateDuration(size int64, bytesPerSecond float64) time.Duration {
+	if size <= 0 || bytesPerSecond <= 0 {
+		return 0
+	}
+	seconds := float64(size) / bytesPerSecond
+	if seconds >= math.MaxInt64/float64(time.Second) {
+		return time.Duration(math.MaxInt64)
+	}
+	d := time.Duration(seconds * float64(time.Second))
+	if d < time.Second {
+		return time.Second
+	}
+	return d.Round(time.Second)
+}
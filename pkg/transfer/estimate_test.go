@@ -0,0 +1,36 @@
+/*
+ *   Copyright (c) 2021 Anton Brekhov
+ *   All rights reserved.
+ */
+package transfer
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestEstimateDuration(t *testing.T) {
+	tests := []struct {
+		name  string
+		size  int64
+		speed float64
+		want  time.Duration
+	}{
+		{"exact", 150 * 1000 * 1000, 1000 * 1000, 150 * time.Second},
+		{"rounded", 2500, 1000, 3 * time.Second},
+		{"less than a second", 10, 1000, time.Second},
+		{"zero size", 0, 1000, 0},
+		{"negative size", -5, 1000, 0},
+		{"zero speed", 1000, 0, 0},
+		{"negative speed", 1000, -1, 0},
+		{"overflow", math.MaxInt64, 1e-9, time.Duration(math.MaxInt64)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := EstimateDuration(tt.size, tt.speed); got != tt.want {
+				t.Errorf("EstimateDuration(%d, %v) = %v, want %v", tt.size, tt.speed, got, tt.want)
+			}
+		})
+	}
+}
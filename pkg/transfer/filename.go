@@ -0,0 +1,32 @@
+/*
+ *   Copyright (c) 2021 Anton Brekhov
+ *   All rights reserved.
+ */
+package transfer
+
+import (
+	"path"
+	"strings"
+	"unicode"
+)
+
+// DefaultFilename replaces names that can't be used as is
+const DefaultFilename = "received"
+
+// SafeFilename returns name sent by peer reduced to a plain file name, so it
+// can't point outside of the current directory: "../evil" becomes "evil"
+func SafeFilename(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, name)
+	// Windows peers send backslash separated paths
+	name = path.Base(strings.ReplaceAll(name, "\\", "/"))
+	switch name {
+	case "/", ".", "..":
+		return DefaultFilename
+	}
+	return name
+}
@@ -0,0 +1,29 @@
+/*
+ *   Copyright (c) 2021 Anton Brekhov
+ *   All rights reserved.
+ */
+package transfer
+
+import "testing"
+
+func TestSafeFilename(t *testing.T) {
+	tests := map[string]string{
+		"report.pdf":          "report.pdf",
+		"../evil":             "evil",
+		"../../etc/passwd":    "passwd",
+		"/etc/passwd":         "passwd",
+		`..\..\windows\evil`:  "evil",
+		"dir/":                "dir",
+		"":                    DefaultFilename,
+		".":                   DefaultFilename,
+		"..":                  DefaultFilename,
+		"/":                   DefaultFilename,
+		"name\x00with\nctrl":  "namewithctrl",
+		"отчёт 2021 (1).docx": "отчёт 2021 (1).docx",
+	}
+	for in, want := range tests {
+		if got := SafeFilename(in); got != want {
+			t.Errorf("SafeFilename(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+/*
+ *   Copyright (c) 2021 Anton Brekhov
+ *   All rights reserved.
+ */
+package transfer
+
+import (
+	"bufio"
+	"io"
+	"sync"
+	"time"
+)
+
+// FlushWriter buffers writes to the underlying writer for throughput and
+// flushes the buffer at least every interval, so a crash loses at most that
+// much of received data
+type FlushWriter struct {
+	mu   sync.Mutex
+	bw   *bufio.Writer
+	err  error
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewFlushWriter wraps w with size bytes buffer. Interval <= 0 flushes only
+// when the buffer fills up and on Close.
+func NewFlushWriter(w io.Writer, size int, interval time.Duration) *FlushWriter {
+	fw := &FlushWriter{
+		bw:   bufio.NewWriterSize(w, size),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	if interval <= 0 {
+		close(fw.done)
+		return fw
+	}
+	go fw.flushEvery(interval)
+	return fw
+}
+
+func (fw *FlushWriter) flushEvery(interval time.Duration) {
+	defer close(fw.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-fw.stop:
+			return
+		case <-ticker.C:
+			fw.Flush()
+		}
+	}
+}
+
+// Write buffers p. It returns error of a failed background flush.
+func (fw *FlushWriter) Write(p []byte) (int, error) {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	if fw.err != nil {
+		return 0, fw.err
+	}
+	n, err := fw.bw.Write(p)
+	fw.err = err
+	return n, err
+}
+
+// Flush writes buffered data to the underlying writer
+func (fw *FlushWriter) Flush() error {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	if fw.err != nil {
+		return fw.err
+	}
+	fw.err = fw.bw.Flush()
+	return fw.err
+}
+
+// Close stops periodic flushing and flushes the rest. The underlying writer
+// is left open.
+func (fw *FlushWriter) Close() error {
+	select {
+	case <-fw.stop:
+	default:
+		close(fw.stop)
+	}
+	<-fw.done
+	return fw.Flush()
+}
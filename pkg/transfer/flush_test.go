@@ -0,0 +1,76 @@
+/*
+ *   Copyright (c) 2021 Anton Brekhov
+ *   All rights reserved.
+ */
+package transfer
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncBuffer is bytes.Buffer safe to read while FlushWriter flushes into it
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Len()
+}
+
+func TestFlushWriterInterval(t *testing.T) {
+	var out syncBuffer
+	fw := NewFlushWriter(&out, 1<<20, 20*time.Millisecond)
+
+	fw.Write([]byte("first"))
+	if out.Len() != 0 {
+		t.Fatal("small write was not buffered")
+	}
+	deadline := time.Now().Add(time.Second)
+	for out.Len() != len("first") {
+		if time.Now().After(deadline) {
+			t.Fatal("buffer not flushed within interval")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	fw.Write([]byte("second"))
+	if err := fw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := out.buf.String(); got != "firstsecond" {
+		t.Errorf("written %q, want %q", got, "firstsecond")
+	}
+}
+
+func TestFlushWriterNoInterval(t *testing.T) {
+	var out syncBuffer
+	fw := NewFlushWriter(&out, 16, 0)
+
+	fw.Write([]byte("short"))
+	time.Sleep(20 * time.Millisecond)
+	if out.Len() != 0 {
+		t.Error("flushed without interval before buffer filled")
+	}
+	if err := fw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if out.Len() != len("short") {
+		t.Errorf("written %d bytes on close, want %d", out.Len(), len("short"))
+	}
+	// Closing twice is harmless
+	if err := fw.Close(); err != nil {
+		t.Error(err)
+	}
+}
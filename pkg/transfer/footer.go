@@ -0,0 +1,80 @@
+/*
+ *   Copyright (c) 2021 Anton Brekhov
+ *   All rights reserved.
+ */
+package transfer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// FooterPrefix starts the text message sent after the last data chunk
+const FooterPrefix = "HT_FOOT:"
+
+var (
+	// ErrChecksumMismatch is returned when received data hashes differently
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+	// ErrSizeMismatch is returned when received byte count differs from sent
+	ErrSizeMismatch = errors.New("size mismatch")
+)
+
+// Footer carries what is only known once everything was sent: checksum of
+// the data and how many bytes were sent. It makes streams of unknown size
+// verifiable.
+type Footer struct {
+	Algorithm string `json:"algorithm"`
+	Checksum  string `json:"checksum"`
+	Size      int64  `json:"size"`
+}
+
+// NewFooter returns footer for everything written to cw
+func NewFooter(cw *ChecksumWriter) Footer {
+	return Footer{
+		Algorithm: "sha256",
+		Checksum:  cw.SumHex(),
+		Size:      cw.BytesWritten(),
+	}
+}
+
+// IsFooter tells whether message is a footer
+func IsFooter(msg string) bool {
+	return strings.HasPrefix(msg, FooterPrefix)
+}
+
+// EncodeFooter returns footer message
+func EncodeFooter(f Footer) (string, error) {
+	b, err := json.Marshal(f)
+	if err != nil {
+		return "", err
+	}
+	return FooterPrefix + string(b), nil
+}
+
+// ParseFooter parses message made by EncodeFooter
+func ParseFooter(msg string) (Footer, error) {
+	var f Footer
+	if !IsFooter(msg) {
+		return f, errors.New("not a footer message")
+	}
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(msg, FooterPrefix)), &f); err != nil {
+		return f, fmt.Errorf("invalid footer: %w", err)
+	}
+	return f, nil
+}
+
+// Verify checks that data written to cw matches the footer
+func (f Footer) Verify(cw *ChecksumWriter) error {
+	if f.Algorithm != "" && f.Algorithm != "sha256" {
+		return fmt.Errorf("unsupported checksum algorithm %q", f.Algorithm)
+	}
+	if got := cw.BytesWritten(); got != f.Size {
+		return fmt.Errorf("%w: received %d bytes, sender sent %d", ErrSizeMismatch, got, f.Size)
+	}
+	if got := cw.SumHex(); got != f.Checksum {
+		return fmt.Errorf("%w: received %s, sender sent %s", ErrChecksumMismatch, got, f.Checksum)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+/*
+ *   Copyright (c) 2021 Anton Brekhov
+ *   All rights reserved.
+ */
+package transfer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestFooterVerifiesStream(t *testing.T) {
+	data := make([]byte, 300*1024+5)
+	rand.Read(data)
+
+	// Sender doesn't know the size upfront, it hashes while streaming
+	var wire bytes.Buffer
+	sent := NewChecksumWriter(&wire)
+	if _, err := io.Copy(sent, bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := EncodeFooter(NewFooter(sent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsFooter(msg) {
+		t.Fatalf("%q is not recognized as footer", msg)
+	}
+	footer, err := ParseFooter(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("intact", func(t *testing.T) {
+		received := NewChecksumWriter(io.Discard)
+		received.Write(wire.Bytes())
+		if err := footer.Verify(received); err != nil {
+			t.Error(err)
+		}
+	})
+	t.Run("corrupted", func(t *testing.T) {
+		corrupted := append([]byte{}, wire.Bytes()...)
+		corrupted[1000] ^= 0xff
+		received := NewChecksumWriter(io.Discard)
+		received.Write(corrupted)
+		if err := footer.Verify(received); !errors.Is(err, ErrChecksumMismatch) {
+			t.Errorf("err = %v, want ErrChecksumMismatch", err)
+		}
+	})
+	t.Run("truncated", func(t *testing.T) {
+		received := NewChecksumWriter(io.Discard)
+		received.Write(wire.Bytes()[:wire.Len()-1])
+		if err := footer.Verify(received); !errors.Is(err, ErrSizeMismatch) {
+			t.Errorf("err = %v, want ErrSizeMismatch", err)
+		}
+	})
+}
+
+func TestParseFooterInvalid(t *testing.T) {
+	for _, msg := range []string{"HT_READY:", FooterPrefix + "{broken"} {
+		if _, err := ParseFooter(msg); err == nil {
+			t.Errorf("ParseFooter(%q) expected error", msg)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+/*
+ *   Copyright (c) 2021 Anton Brekhov
+ *   All rights reserved.
+ */
+package transfer
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// RateLimiter paces sending to average bytes per second using token bucket.
+// Nil or zero-rate limiter doesn't limit anything.
+type RateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter creates limiter allowing bytesPerSec on average with up to
+// one second worth of burst after idling. Zero or negative rate is unlimited.
+func NewRateLimiter(bytesPerSec int64) *RateLimiter {
+	return &RateLimiter{
+		rate:  float64(bytesPerSec),
+		burst: float64(bytesPerSec),
+		last:  time.Now(),
+	}
+}
+
+// Wait blocks until n bytes may be sent
+func (rl *RateLimiter) Wait(n int) {
+	if rl == nil || rl.rate <= 0 {
+		return
+	}
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := time.Now()
+	rl.tokens += now.Sub(rl.last).Seconds() * rl.rate
+	if rl.tokens > rl.burst {
+		rl.tokens = rl.burst
+	}
+	rl.last = now
+
+	// Go into debt and sleep it off, so chunks larger than burst still pass
+	rl.tokens -= float64(n)
+	if rl.tokens < 0 {
+		time.Sleep(time.Duration(-rl.tokens / rl.rate * float64(time.Second)))
+	}
+}
+
+// Reader returns r paced by the limiter
+func (rl *RateLimiter) Reader(r io.Reader) io.Reader {
+	return &rateLimitedReader{r: r, rl: rl}
+}
+
+type rateLimitedReader struct {
+	r  io.Reader
+	rl *RateLimiter
+}
+
+func (lr *rateLimitedReader) Read(p []byte) (int, error) {
+	n, err := lr.r.Read(p)
+	if n > 0 {
+		lr.rl.Wait(n)
+	}
+	return n, err
+}
@@ -0,0 +1,42 @@
+/*
+ *   Copyright (c) 2021 Anton Brekhov
+ *   All rights reserved.
+ */
+package transfer
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiterPaces(t *testing.T) {
+	const rate = 1000 * 1000 // 1MB/s
+	const chunk = 16 * 1024
+	const chunks = 20
+
+	rl := NewRateLimiter(rate)
+	start := time.Now()
+	for i := 0; i < chunks; i++ {
+		rl.Wait(chunk)
+	}
+	elapsed := time.Since(start)
+
+	want := time.Duration(float64(chunk*chunks) / rate * float64(time.Second))
+	if elapsed < want*95/100 {
+		t.Errorf("sent %d bytes in %v, want at least %v", chunk*chunks, elapsed, want)
+	}
+	if elapsed > want*3 {
+		t.Errorf("sent %d bytes in %v, limiter is too slow (expected ~%v)", chunk*chunks, elapsed, want)
+	}
+}
+
+func TestRateLimiterUnlimited(t *testing.T) {
+	var nilLimiter *RateLimiter
+	for _, rl := range []*RateLimiter{NewRateLimiter(0), NewRateLimiter(-1), nilLimiter} {
+		start := time.Now()
+		rl.Wait(1 << 30)
+		if elapsed := time.Since(start); elapsed > 10*time.Millisecond {
+			t.Errorf("unlimited limiter blocked for %v", elapsed)
+		}
+	}
+}
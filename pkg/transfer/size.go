@@ -0,0 +1,83 @@
+/*
+ *   Copyright (c) 2021 Anton Brekhov
+ *   All rights reserved.
+ */
+package transfer
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var sizeUnits = map[string]float64{
+	"":    1,
+	"B":   1,
+	"K":   1000,
+	"KB":  1000,
+	"KIB": 1 << 10,
+	"M":   1000 * 1000,
+	"MB":  1000 * 1000,
+	"MIB": 1 << 20,
+	"G":   1000 * 1000 * 1000,
+	"GB":  1000 * 1000 * 1000,
+	"GIB": 1 << 30,
+}
+
+// ParseSize parses human readable size like "512", "1.5MB" or "2MiB" to bytes
+func ParseSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if i < 0 {
+		i = len(s)
+	}
+	value, err := strconv.ParseFloat(s[:i], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	multiplier, ok := sizeUnits[strings.ToUpper(strings.TrimSpace(s[i:]))]
+	if !ok {
+		return 0, fmt.Errorf("invalid size unit in %q", s)
+	}
+	return int64(value * multiplier), nil
+}
+
+// FormatSize formats bytes with decimal units, e.g. "1.5 MB"
+func FormatSize(bytes int64) string {
+	return FormatSizeWithUnit(bytes, false)
+}
+
+// FormatSizeBinary formats bytes with binary units, e.g. "1.5 MiB"
+func FormatSizeBinary(bytes int64) string {
+	return FormatSizeWithUnit(bytes, true)
+}
+
+// FormatSizeWithUnit formats bytes with binary (1024-based, KiB) or decimal
+// (1000-based, KB) units, the same ones ParseSize understands
+func FormatSizeWithUnit(bytes int64, binary bool) string {
+	base, units := int64(1000), []string{"KB", "MB", "GB", "TB"}
+	if binary {
+		base, units = 1024, []string{"KiB", "MiB", "GiB", "TiB"}
+	}
+	if bytes < base && bytes > -base {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	value := float64(bytes) / float64(base)
+	i := 0
+	// Compare what gets printed, 999999 is "1.0 MB" rather than "1000.0 KB"
+	for ; i < len(units)-1 && math.Abs(roundTenths(value)) >= float64(base); i++ {
+		value /= float64(base)
+	}
+	return fmt.Sprintf("%.1f %s", roundTenths(value), units[i])
+}
+
+// roundTenths rounds v to one decimal place
+func roundTenths(v float64) float64 {
+	return math.Round(v*10) / 10
+}
@@ -0,0 +1,69 @@
+/*
+ *   Copyright (c) 2021 Anton Brekhov
+ *   All rights reserved.
+ */
+package transfer
+
+import "testing"
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"0", 0, false},
+		{"512", 512, false},
+		{"512B", 512, false},
+		{"2MB", 2000000, false},
+		{"2mb", 2000000, false},
+		{"1.5M", 1500000, false},
+		{"2MiB", 2 << 20, false},
+		{"10 KiB", 10 << 10, false},
+		{"1GB", 1000000000, false},
+		{"MB", 0, true},
+		{"2XB", 0, true},
+		{"-1MB", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseSize(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseSize(%q) err = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseSize(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestFormatSizeWithUnit(t *testing.T) {
+	tests := []struct {
+		in      int64
+		decimal string
+		binary  string
+	}{
+		{0, "0 B", "0 B"},
+		{999, "999 B", "999 B"},
+		{1000, "1.0 KB", "1000 B"},
+		{1023, "1.0 KB", "1023 B"},
+		{1024, "1.0 KB", "1.0 KiB"},
+		{1500, "1.5 KB", "1.5 KiB"},
+		{1 << 20, "1.0 MB", "1.0 MiB"},
+		{2500000000, "2.5 GB", "2.3 GiB"},
+		// Values rounding up to the next unit are shown in it
+		{999949, "999.9 KB", "976.5 KiB"},
+		{999999, "1.0 MB", "976.6 KiB"},
+		{1048575, "1.0 MB", "1.0 MiB"},
+		{-999999, "-1.0 MB", "-976.6 KiB"},
+	}
+	for _, tt := range tests {
+		if got := FormatSize(tt.in); got != tt.decimal {
+			t.Errorf("FormatSize(%d) = %q, want %q", tt.in, got, tt.decimal)
+		}
+		if got := FormatSizeBinary(tt.in); got != tt.binary {
+			t.Errorf("FormatSizeBinary(%d) = %q, want %q", tt.in, got, tt.binary)
+		}
+	}
+}
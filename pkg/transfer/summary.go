@@ -0,0 +1,79 @@
+/*
+ *   Copyright (c) 2021 Anton Brekhov
+ *   All rights reserved.
+ */
+package transfer
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// summaryMu serializes summary lines of concurrent transfers
+var summaryMu sync.Mutex
+
+// Status describes a finished transfer
+type Status struct {
+	Filename string
+	Size     int64
+	Started  time.Time
+	Finished time.Time
+	// Checksum is hex SHA-256 of transferred data, empty when unknown
+	Checksum string
+	// Err is why transfer failed, nil on success
+	Err error
+}
+
+// Duration returns how long transfer took
+func (s *Status) Duration() time.Duration {
+	return s.Finished.Sub(s.Started)
+}
+
+// Speed returns average speed in bytes per second, 0 when unknown
+func (s *Status) Speed() float64 {
+	if d := s.Duration(); d > 0 {
+		return float64(s.Size) / d.Seconds()
+	}
+	return 0
+}
+
+// summaryRecord is JSON line written by WriteSummary
+type summaryRecord struct {
+	Time     time.Time `json:"time"`
+	File     string    `json:"file"`
+	Size     int64     `json:"size"`
+	Duration float64   `json:"duration"`
+	Speed    float64   `json:"speed"`
+	Checksum string    `json:"checksum,omitempty"`
+	Success  bool      `json:"success"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// WriteSummary writes status as a single JSON line, so summaries of many
+// transfers appended to one file make an ndjson log. Duration is in seconds,
+// speed in bytes per second.
+func WriteSummary(w io.Writer, status *Status) error {
+	rec := summaryRecord{
+		Time:     status.Finished,
+		File:     status.Filename,
+		Size:     status.Size,
+		Duration: status.Duration().Seconds(),
+		Speed:    status.Speed(),
+		Checksum: status.Checksum,
+		Success:  status.Err == nil,
+	}
+	if status.Err != nil {
+		rec.Error = status.Err.Error()
+	}
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	summaryMu.Lock()
+	defer summaryMu.Unlock()
+	// One write per line keeps lines whole in O_APPEND files
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
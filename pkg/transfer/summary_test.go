@@ -0,0 +1,106 @@
+/*
+ *   Copyright (c) 2021 Anton Brekhov
+ *   All rights reserved.
+ */
+package transfer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWriteSummary(t *testing.T) {
+	started := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	cw := NewChecksumWriter(io.Discard)
+	cw.Write(bytes.Repeat([]byte("x"), 4096))
+
+	var log bytes.Buffer
+	ok := &Status{
+		Filename: "report.pdf",
+		Size:     cw.BytesWritten(),
+		Started:  started,
+		Finished: started.Add(2 * time.Second),
+		Checksum: cw.SumHex(),
+	}
+	failed := &Status{
+		Filename: "video.mp4",
+		Size:     100,
+		Started:  started,
+		Finished: started.Add(time.Second),
+		Err:      errors.New("connection lost"),
+	}
+	for _, s := range []*Status{ok, failed} {
+		if err := WriteSummary(&log, s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var records []map[string]interface{}
+	scanner := bufio.NewScanner(&log)
+	for scanner.Scan() {
+		var rec map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			t.Fatalf("line %q: %v", scanner.Text(), err)
+		}
+		records = append(records, rec)
+	}
+	if len(records) != 2 {
+		t.Fatalf("got %d lines, want 2", len(records))
+	}
+
+	want := map[string]interface{}{
+		"time":     "2021-06-01T12:00:02Z",
+		"file":     "report.pdf",
+		"size":     4096.0,
+		"duration": 2.0,
+		"speed":    2048.0,
+		"checksum": cw.SumHex(),
+		"success":  true,
+	}
+	for k, v := range want {
+		if records[0][k] != v {
+			t.Errorf("%s = %v, want %v", k, records[0][k], v)
+		}
+	}
+	if _, ok := records[0]["error"]; ok {
+		t.Error("successful transfer has error field")
+	}
+	if records[1]["success"] != false || records[1]["error"] != "connection lost" {
+		t.Errorf("failed transfer record = %v", records[1])
+	}
+	if _, ok := records[1]["checksum"]; ok {
+		t.Error("unknown checksum written")
+	}
+}
+
+func TestWriteSummaryConcurrent(t *testing.T) {
+	var log bytes.Buffer
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			WriteSummary(&log, &Status{Filename: "file.bin", Size: 1})
+		}()
+	}
+	wg.Wait()
+
+	lines := 0
+	scanner := bufio.NewScanner(&log)
+	for scanner.Scan() {
+		var rec summaryRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			t.Fatalf("garbled line %q: %v", scanner.Text(), err)
+		}
+		lines++
+	}
+	if lines != 20 {
+		t.Errorf("got %d lines, want 20", lines)
+	}
+}